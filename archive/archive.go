@@ -0,0 +1,375 @@
+// Package archive opens, lists and extracts archives in any of the supported
+// formats, detecting the format from the contents of the file. Importing it
+// registers the CMZ, NSK, TSC and ZAR formats.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	c "github.com/sourcekris/dclextract/common"
+
+	// Register the supported archive formats.
+	_ "github.com/sourcekris/dclextract/cmz"
+	_ "github.com/sourcekris/dclextract/nsk"
+	_ "github.com/sourcekris/dclextract/tsc"
+	"github.com/sourcekris/dclextract/zar"
+)
+
+// ErrUnknownFormat is matched by the error returned for a file that is not
+// in any registered format.
+var ErrUnknownFormat = errors.New("unknown file type")
+
+// File is an open archive file: a single file, or the volumes of a spanned
+// archive read as one.
+type File interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// Archive is an open archive.
+type Archive struct {
+	Format c.Format
+	Paths  []string // Files the archive is stored in, in order: the volumes of a spanned archive, or a single file. Nil for readers.
+
+	name   string    // Path of the archive, used to name nameless members; empty for readers.
+	f      File      // Nil for archives streamed from a reader.
+	stream io.Reader // Data of an archive streamed from a reader, until its members are read.
+}
+
+// Open opens the archive at path and detects its format. If path is any
+// volume of a spanned ZAR archive, the whole volume set is opened: its
+// numbered siblings are found as by zar.VolumePaths.
+func Open(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := detect(f, path)
+
+	// The last volume of a spanned ZAR archive holds the info block, but not
+	// all of the table of contents and data, so it may not be recognized on
+	// its own, and the other volumes hold nothing but member data.
+	if zf, ok := c.Lookup(c.TypeZAR); ok && (err != nil || format == zf) {
+		a, spanErr := openSpanned(f, path, err == nil)
+		if a != nil || spanErr != nil {
+			f.Close()
+			return a, spanErr
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Archive{Format: format, Paths: []string{path}, name: path, f: f}, nil
+}
+
+// openSpanned opens the volume set that f, opened from path, belongs to. If
+// f ends with a ZAR info block with the multi-volume flag set, it is the last
+// volume, and an error is returned if another volume is missing. Otherwise,
+// unless f was recognized as an archive by itself, it may be an earlier
+// volume, and its numbered siblings are opened if the last of them is the
+// last volume of a spanned ZAR archive. openSpanned returns nil if f is not
+// part of a volume set.
+func openSpanned(f File, path string, recognized bool) (*Archive, error) {
+	info, err := zar.ReadInfo(f)
+	last := err == nil && info.Config.MultiVolume()
+	if !last && recognized {
+		return nil, nil
+	}
+	paths, err := zar.VolumePaths(path)
+	if err != nil && !last {
+		// Without the info block the files are not known to be volumes.
+		return nil, nil
+	}
+	if err != nil || len(paths) < 2 {
+		return nil, err
+	}
+	a := openVolumes(paths)
+	if a != nil {
+		a.name = path
+	}
+	return a, nil
+}
+
+// openVolumes opens paths as a spanned ZAR archive. It returns nil if the
+// last volume does not carry a ZAR info block with the multi-volume flag set,
+// or the volumes together are not recognized as a ZAR archive, in which case
+// the files are treated as unrelated.
+func openVolumes(paths []string) *Archive {
+	v, err := zar.OpenVolumes(paths)
+	if err != nil {
+		return nil
+	}
+	info, err := zar.ReadInfo(v)
+	if err != nil || !info.Config.MultiVolume() {
+		v.Close()
+		return nil
+	}
+	if ft, err := c.Detect(v); err != nil || ft != c.TypeZAR {
+		v.Close()
+		return nil
+	}
+	format, _ := c.Lookup(c.TypeZAR)
+	return &Archive{Format: format, Paths: paths, f: v}
+}
+
+// peekSize is how much of a stream is examined to detect its format.
+const peekSize = 64 << 10
+
+// OpenReader reads an archive from r into a temporary file, which is removed
+// when the archive is closed, and detects its format.
+func OpenReader(r io.Reader) (*Archive, error) {
+	f, err := spool(r)
+	if err != nil {
+		return nil, fmt.Errorf("spooling archive: %w", err)
+	}
+	format, err := detect(f, "")
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Archive{Format: format, f: f}, nil
+}
+
+// OpenStream opens an archive read from r, detecting its format from the
+// first 64 KiB. Formats that can be read front to back are streamed from r,
+// so the archive's members can be read only once and it cannot be listed up
+// front. Other formats, such as ZAR with its table of contents at the end, are
+// read into a temporary file as by OpenReader.
+func OpenStream(r io.Reader) (*Archive, error) {
+	br := bufio.NewReaderSize(r, peekSize)
+	peek, err := br.Peek(peekSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	fileType, err := c.Detect(bytes.NewReader(peek))
+	if err != nil {
+		return nil, err
+	}
+	format, ok := c.Lookup(fileType)
+	if _, streamable := format.(c.Streamer); ok && streamable {
+		return &Archive{Format: format, stream: br}, nil
+	}
+	return OpenReader(br)
+}
+
+// spooledFile is a temporary copy of an archive that is removed on Close.
+type spooledFile struct {
+	*os.File
+}
+
+// spool copies r to a new temporary file positioned at the start.
+func spool(r io.Reader) (*spooledFile, error) {
+	f, err := os.CreateTemp("", "dclextract-*")
+	if err != nil {
+		return nil, err
+	}
+	sf := &spooledFile{f}
+	if _, err := io.Copy(f, r); err != nil {
+		sf.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		sf.Close()
+		return nil, err
+	}
+	return sf, nil
+}
+
+func (f *spooledFile) Close() error {
+	return errors.Join(f.File.Close(), os.Remove(f.Name()))
+}
+
+// Detect examines the contents of rs to determine its format and seeks rs back
+// to the start. The error matches ErrUnknownFormat and c.ErrBadMagic if rs is
+// not in any registered format.
+func Detect(rs io.ReadSeeker) (c.Format, error) {
+	return detect(rs, "")
+}
+
+// detect implements Detect, naming the archive path in errors if it is set.
+func detect(rs io.ReadSeeker, path string) (c.Format, error) {
+	fileType, err := c.Detect(rs)
+	if err != nil {
+		return nil, err
+	}
+	format, ok := c.Lookup(fileType)
+	if !ok {
+		err := ErrUnknownFormat
+		if path != "" {
+			err = fmt.Errorf("%w for %s", ErrUnknownFormat, path)
+		}
+		return nil, &c.FormatError{Member: -1, Offset: -1, Kind: c.ErrBadMagic, Err: err}
+	}
+	return format, nil
+}
+
+// Close closes the archive.
+func (a *Archive) Close() error {
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+// List reads the member headers of the archive without decompressing. It
+// returns c.ErrNotSeekable for archives streamed by OpenStream.
+func (a *Archive) List() ([]c.Header, error) {
+	if a.f == nil {
+		return nil, c.ErrNotSeekable
+	}
+	if _, err := a.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	headers, err := a.Format.List(a.f)
+	if _, seekErr := a.f.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	return headers, err
+}
+
+// OpenMember returns a reader for the decompressed data of the i'th member,
+// described by h as returned by List. Members can be read concurrently. It
+// returns c.ErrNotSeekable for archives streamed by OpenStream.
+func (a *Archive) OpenMember(i int, h *c.Header) (io.ReadCloser, error) {
+	if a.f == nil {
+		return nil, c.ErrNotSeekable
+	}
+	return c.NewMemberReader(io.NewSectionReader(a.f, h.Offset, int64(h.CompressedSize)), a.Format.Name(), i, h), nil
+}
+
+// Members returns a reader for the members that keep selects, or all of them
+// if keep is nil. Up to parallel members are decompressed at once if all of
+// their offsets can be read up front. The members of an archive streamed by
+// OpenStream can be read only once.
+func (a *Archive) Members(parallel int, keep c.SelectFunc) (c.MemberReader, error) {
+	r, _, err := a.members(parallel, keep)
+	return r, err
+}
+
+// members implements Members, also returning the headers of all members if
+// they could be read up front.
+func (a *Archive) members(parallel int, keep c.SelectFunc) (c.MemberReader, []c.Header, error) {
+	if a.f == nil {
+		if a.stream == nil {
+			return nil, nil, errors.New("archive: members of a stream can only be read once")
+		}
+		r := a.Format.(c.Streamer).NewStreamReader(a.stream)
+		a.stream = nil
+		return selectMembers(r, keep), nil, nil
+	}
+
+	// Members can only be decompressed in parallel once all of their offsets
+	// are known. Damaged archives are streamed so that the error is reported
+	// where extraction reaches it.
+	headers, listErr := a.List()
+	if parallel > 1 && listErr == nil {
+		return c.NewParallelReader(a.f, a.Format.Name(), headers, parallel, keep), headers, nil
+	}
+	return selectMembers(a.Format.NewReader(a.f), keep), headers, nil
+}
+
+// selectMembers returns r limited to the members that keep selects, or r
+// itself if keep is nil.
+func selectMembers(r c.MemberReader, keep c.SelectFunc) c.MemberReader {
+	if keep == nil {
+		return r
+	}
+	return c.Select(r, keep)
+}
+
+// List returns the member headers of the archive at path.
+func List(path string) ([]c.Header, error) {
+	a, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	return a.List()
+}
+
+// Extract decompresses every member of the archive at path into memory.
+func Extract(path string) ([]c.ExtractedFileData, error) {
+	a, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	return a.Extract()
+}
+
+// ExtractTo extracts the archive at path into dir, returning the number of
+// files written. See Archive.ExtractTo.
+func ExtractTo(path, dir string, opts *Options) (int, error) {
+	a, err := Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer a.Close()
+	return a.ExtractTo(dir, opts)
+}
+
+// FS is a read-only file system view of an archive, as returned by OpenFS and
+// Archive.FS. Nameless members are named as by ExtractTo. See c.FS.
+type FS struct {
+	*c.FS
+	a *Archive
+}
+
+// Close closes the archive if the FS was returned by OpenFS.
+func (fsys *FS) Close() error {
+	if fsys.a == nil {
+		return nil
+	}
+	return fsys.a.Close()
+}
+
+// FS returns a file system view of the archive, which must stay open while
+// the FS is used. It returns c.ErrNotSeekable for archives streamed by
+// OpenStream.
+func (a *Archive) FS() (*FS, error) {
+	if a.f == nil {
+		return nil, c.ErrNotSeekable
+	}
+	size, err := c.ArchiveSize(a.f)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	names := newNamer(a.name, len(headers))
+	fsys, err := c.NewFS(a.f, size, a.Format, names.next)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{FS: fsys}, nil
+}
+
+// OpenFS opens the archive at path as a read-only file system, as Open does,
+// so a spanned ZAR archive can be opened from any of its volumes. The FS must
+// be closed to close the archive.
+func OpenFS(path string) (*FS, error) {
+	a, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := a.FS()
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	fsys.a = a
+	return fsys, nil
+}
@@ -0,0 +1,310 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// writeVolumes writes data split at the given offsets to FOO.ZA1, FOO.ZA2 and
+// so on in dir, and returns their paths.
+func writeVolumes(t *testing.T, dir string, data []byte, splits ...int) []string {
+	t.Helper()
+	var paths []string
+	start := 0
+	for i, end := range append(splits, len(data)) {
+		paths = append(paths, writeFile(t, dir, "FOO.ZA"+string(rune('1'+i)), data[start:end]))
+		start = end
+	}
+	return paths
+}
+
+func TestOpenSpanned(t *testing.T) {
+	members := []zarMember{
+		{name: "A.TXT", data: []byte("first member, stored on the first disk")},
+		{name: "B.TXT", data: []byte("second member, split across the disks")},
+	}
+
+	t.Run("multi-volume", func(t *testing.T) {
+		dir := t.TempDir()
+		data := zarArchive(t, 0x0080, members)
+		paths := writeVolumes(t, dir, data, 20, len(data)-10)
+
+		// Any volume opens the whole set.
+		for _, path := range paths {
+			a, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open(%s): %v", filepath.Base(path), err)
+			}
+			if !reflect.DeepEqual(a.Paths, paths) {
+				t.Errorf("Open(%s) Paths = %q, want %q", filepath.Base(path), a.Paths, paths)
+			}
+			files, err := a.Extract()
+			a.Close()
+			if err != nil {
+				t.Fatalf("Extract from %s: %v", filepath.Base(path), err)
+			}
+			for i, m := range members {
+				if files[i].Filename != m.name || string(files[i].Data) != string(m.data) {
+					t.Errorf("member %d = %s %q, want %s %q", i, files[i].Filename, files[i].Data, m.name, m.data)
+				}
+			}
+		}
+	})
+
+	t.Run("missing volume", func(t *testing.T) {
+		dir := t.TempDir()
+		data := zarArchive(t, 0x0080, members)
+		paths := writeVolumes(t, dir, data, 10, 20, len(data)-10)
+		if err := os.Remove(paths[1]); err != nil {
+			t.Fatal(err)
+		}
+		if a, err := Open(paths[len(paths)-1]); err == nil {
+			a.Close()
+			t.Errorf("Open succeeded with volume %s missing", filepath.Base(paths[1]))
+		}
+	})
+
+	t.Run("unrelated numbered files", func(t *testing.T) {
+		// An unrecognized file is not a volume unless the last of its
+		// numbered siblings is the last volume of a spanned archive.
+		dir := t.TempDir()
+		path := writeFile(t, dir, "FOO.ZA1", []byte("unrelated"))
+		writeFile(t, dir, "FOO.ZA2", zarArchive(t, 0, members))
+		if a, err := Open(path); !errors.Is(err, ErrUnknownFormat) {
+			if err == nil {
+				a.Close()
+			}
+			t.Errorf("Open error = %v, want %v", err, ErrUnknownFormat)
+		}
+	})
+
+	t.Run("not multi-volume", func(t *testing.T) {
+		// Numbered siblings are not volumes unless the flag is set.
+		dir := t.TempDir()
+		writeFile(t, dir, "FOO.ZA1", []byte("unrelated"))
+		path := writeFile(t, dir, "FOO.ZA2", zarArchive(t, 0, members))
+
+		a, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer a.Close()
+		if want := []string{path}; !reflect.DeepEqual(a.Paths, want) {
+			t.Errorf("Paths = %q, want %q", a.Paths, want)
+		}
+	})
+}
+
+// readMembers reads the members of a that keep selects, decompressing up to
+// parallel at once, and returns their names and contents.
+func readMembers(t *testing.T, a *Archive, parallel int, keep c.SelectFunc) []string {
+	t.Helper()
+	r, err := a.Members(parallel, keep)
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	var got []string
+	for {
+		h, mr, err := r.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		data, err := io.ReadAll(mr)
+		if err != nil {
+			t.Fatalf("reading %s: %v", h.Filename, err)
+		}
+		got = append(got, h.Filename+": "+string(data))
+	}
+}
+
+// unseekable returns a reader for data that supports neither seeking nor
+// io.ReaderAt, and returns it in small pieces.
+func unseekable(data []byte) io.Reader {
+	return io.MultiReader(iotest.HalfReader(bytes.NewReader(data)))
+}
+
+// noise returns n bytes that do not compress, so that archives holding it are
+// larger than the part of a stream examined to detect its format.
+func noise(n int) string {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return string(b)
+}
+
+func TestOpenStream(t *testing.T) {
+	// Each archive is larger than peekSize.
+	text, bin := strings.Repeat("contents of A.TXT. ", 100), noise(peekSize+1000)
+	for _, tc := range []struct {
+		format string
+		data   []byte
+	}{
+		{"CMZ", cmzArchiveWith(t, cmzMember{name: "A.TXT", data: text}, cmzMember{name: "B.BIN", data: bin})},
+		{"NSK", nskArchive(t, member{"A.TXT", text}, member{"B.BIN", bin})},
+		{"TSC", tscArchive(t, member{"A.TXT", text}, member{"B.BIN", bin})},
+	} {
+		t.Run("streamed "+tc.format, func(t *testing.T) {
+			if len(tc.data) <= peekSize {
+				t.Fatalf("archive of %d bytes fits in the peeked data", len(tc.data))
+			}
+			a, err := OpenStream(unseekable(tc.data))
+			if err != nil {
+				t.Fatalf("OpenStream: %v", err)
+			}
+			defer a.Close()
+			if a.Format.Name() != tc.format || a.f != nil {
+				t.Fatalf("OpenStream opened %s, spooled %v; want %s streamed", a.Format.Name(), a.f != nil, tc.format)
+			}
+			if _, err := a.List(); !errors.Is(err, c.ErrNotSeekable) {
+				t.Errorf("List error = %v, want %v", err, c.ErrNotSeekable)
+			}
+			want := []string{"A.TXT: " + text, "B.BIN: " + bin}
+			if got := readMembers(t, a, 1, nil); !reflect.DeepEqual(got, want) {
+				t.Errorf("members differ from those stored")
+			}
+			if _, err := a.Members(1, nil); err == nil {
+				t.Errorf("Members succeeded a second time")
+			}
+		})
+
+		t.Run("streamed "+tc.format+" selected", func(t *testing.T) {
+			// Members that are not selected are skipped unread.
+			a, err := OpenStream(unseekable(tc.data))
+			if err != nil {
+				t.Fatalf("OpenStream: %v", err)
+			}
+			defer a.Close()
+			keep := func(i int, h *c.Header) bool { return h.Filename == "B.BIN" }
+			if got, want := readMembers(t, a, 1, keep), []string{"B.BIN: " + bin}; !reflect.DeepEqual(got, want) {
+				t.Errorf("selected members differ from those stored")
+			}
+		})
+	}
+
+	t.Run("spooled", func(t *testing.T) {
+		// The table of contents of a ZAR archive is at the end, past the part
+		// of the stream examined to detect its format.
+		bin := noise(peekSize + 1000)
+		members := []zarMember{{name: "A.TXT", data: []byte("a")}, {name: "B.BIN", data: []byte(bin)}}
+		a, err := OpenStream(unseekable(zarArchive(t, 0, members)))
+		if err != nil {
+			t.Fatalf("OpenStream: %v", err)
+		}
+		sf, ok := a.f.(*spooledFile)
+		if a.Format.Name() != "ZAR" || !ok {
+			a.Close()
+			t.Fatalf("OpenStream opened %s from %T; want ZAR from a temporary file", a.Format.Name(), a.f)
+		}
+		headers, err := a.List()
+		if err != nil || len(headers) != 2 {
+			t.Errorf("List = %d headers, %v; want 2", len(headers), err)
+		}
+		want := []string{"A.TXT: a", "B.BIN: " + bin}
+		for i := 0; i < 2; i++ {
+			if got := readMembers(t, a, 1, nil); !reflect.DeepEqual(got, want) {
+				t.Errorf("members on read %d differ from those stored", i+1)
+			}
+		}
+		if err := a.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if _, err := os.Stat(sf.Name()); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("temporary file %s not removed: %v", sf.Name(), err)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if a, err := OpenStream(strings.NewReader("plain text")); err == nil {
+			a.Close()
+			t.Errorf("OpenStream succeeded on plain text")
+		}
+	})
+}
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string // Empty for an unknown format.
+	}{
+		{"CMZ", cmzArchive(t, "A.TXT"), "CMZ"},
+		{"ZAR", zarArchive(t, 0, []zarMember{{name: "A.TXT", data: []byte("a")}}), "ZAR"},
+		{"text", []byte(strings.Repeat("Some notes about the release.\r\n", 10)), ""},
+		{"empty", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := bytes.NewReader(tc.data)
+			rs.Seek(int64(len(tc.data)/2), io.SeekStart)
+			format, err := Detect(rs)
+			if tc.want == "" {
+				if !errors.Is(err, ErrUnknownFormat) || !errors.Is(err, c.ErrBadMagic) {
+					t.Errorf("Detect error = %v, want %v and %v", err, ErrUnknownFormat, c.ErrBadMagic)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Detect: %v", err)
+			}
+			if format.Name() != tc.want {
+				t.Errorf("Detect = %s, want %s", format.Name(), tc.want)
+			}
+			if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("Detect left the reader at %d, want 0", pos)
+			}
+		})
+	}
+
+	// Open names the file in the error.
+	path := writeFile(t, t.TempDir(), "NOTES.TXT", []byte("plain text"))
+	if _, err := Open(path); !errors.Is(err, ErrUnknownFormat) || !strings.Contains(fmt.Sprint(err), path) {
+		t.Errorf("Open error = %v, want %v naming %s", err, ErrUnknownFormat, path)
+	}
+}
+
+func TestMembersParallel(t *testing.T) {
+	var names []string
+	var zarMembers []zarMember
+	for i := 0; i < 9; i++ {
+		name := fmt.Sprintf("M%d.TXT", i)
+		names = append(names, name)
+		zarMembers = append(zarMembers, zarMember{name: name, data: []byte("contents of " + name)})
+	}
+	dir := t.TempDir()
+	odd := func(i int, h *c.Header) bool { return i%2 == 1 }
+
+	for _, path := range []string{
+		writeFile(t, dir, "DISK1.CMZ", cmzArchive(t, names...)),
+		writeFile(t, dir, "DISK1.ZAR", zarArchive(t, 0, zarMembers)),
+	} {
+		a, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer a.Close()
+		for _, keep := range []c.SelectFunc{nil, odd} {
+			want := readMembers(t, a, 1, keep)
+			if len(want) == 0 {
+				t.Fatalf("no members read from %s", filepath.Base(path))
+			}
+			for _, parallel := range []int{2, 4, 16} {
+				if got := readMembers(t, a, parallel, keep); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s members with %d at once = %q, want %q", filepath.Base(path), parallel, got, want)
+				}
+			}
+		}
+	}
+}
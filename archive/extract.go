@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// Options controls how Archive.ExtractTo writes members to disk.
+type Options struct {
+	Overwrite       OverwritePolicy // What to do when a file already exists.
+	ApplyAttributes bool            // Make members stored as read-only read-only (0444) on disk.
+	Parallel        int             // Number of members decompressed at once; 1 or less streams them in order.
+	Select          c.SelectFunc    // Members to extract; nil extracts them all.
+
+	// Progress, if set, is called after each selected member has been
+	// written, skipped or has failed, in archive order.
+	Progress func(*Result)
+}
+
+// Result describes the extraction of one member.
+type Result struct {
+	Index     int // Position of the member in the archive, counting from 0.
+	Header    *c.Header
+	Name      string // Path of the member relative to the output directory, as sanitized or generated.
+	Generated bool   // Name was generated because the member has no filename.
+	Path      string // File the member was written to; empty if it was skipped or failed.
+	Size      int64  // Number of decompressed bytes written.
+	SHA256    string // Hex-encoded SHA-256 hash of the decompressed data.
+	Skipped   string // Reason the member was not written because of the overwrite policy.
+	Err       error  // Error that stopped extraction at this member.
+
+	// Warnings are errors setting the timestamp or attributes of a file that
+	// was otherwise written successfully.
+	Warnings []error
+}
+
+// ExtractTo writes the members of the archive into dir, creating it if needed,
+// and returns the number of files written. Member paths are sanitized with
+// c.SanitizePath and nameless members are named after the archive. Extraction
+// stops at the first error; files written before it are kept. opts may be nil.
+func (a *Archive) ExtractTo(dir string, opts *Options) (written int, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	// Record the index of each member as it is selected, since the member
+	// readers return headers alone.
+	var selected []int
+	keep := func(i int, h *c.Header) bool {
+		if opts.Select != nil && !opts.Select(i, h) {
+			return false
+		}
+		selected = append(selected, i)
+		return true
+	}
+	r, headers, err := a.members(opts.Parallel, keep)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	names := newNamer(a.name, len(headers))
+	for n := 0; ; n++ {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		res := &Result{Index: selected[n], Header: h, Name: c.SanitizePath(h.Filename)}
+		if res.Name == "" {
+			res.Name, res.Generated = names.next(res.Index), true
+		}
+		err = a.extractMember(res, dir, data, opts)
+		if res.Path != "" {
+			written++
+		}
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// extractMember writes the decompressed data of the member described by res
+// to its file below dir and fills in the rest of res.
+func (a *Archive) extractMember(res *Result, dir string, data io.Reader, opts *Options) error {
+	h := res.Header
+	dest, skip, err := opts.Overwrite.resolve(filepath.Join(dir, res.Name), h.ModTime)
+	if err != nil {
+		res.Err = err
+		return err
+	}
+	if skip != "" {
+		res.Skipped = skip
+		return nil
+	}
+
+	n, hash, err := writeMember(dest, data)
+	if err != nil {
+		res.Err = err
+		return fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
+	}
+	res.Path, res.Size, res.SHA256 = dest, n, hash
+	if !h.ModTime.IsZero() {
+		if err := os.Chtimes(dest, h.ModTime, h.ModTime); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Errorf("setting modification time of %s: %w", dest, err))
+		}
+	}
+	if opts.ApplyAttributes && h.Attributes&c.AttrReadOnly != 0 {
+		if err := os.Chmod(dest, 0444); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Errorf("making %s read-only: %w", dest, err))
+		}
+	}
+	return nil
+}
+
+// writeMember copies a member's decompressed data to a new file at path and
+// returns its length and hex-encoded SHA-256 hash. An existing read-only file,
+// such as one extracted earlier with ApplyAttributes, is made writable and
+// replaced. The file is removed again if the data cannot be fully written.
+func writeMember(path string, data io.Reader) (int64, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, "", err
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode().IsRegular() && fi.Mode().Perm()&0200 == 0 {
+		if err := os.Chmod(path, fi.Mode().Perm()|0200); err != nil {
+			return 0, "", err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(f, io.TeeReader(data, hash))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return n, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Extract decompresses every member of the archive into memory. Nameless
+// members are given the name they would be extracted under by ExtractTo.
+func (a *Archive) Extract() ([]c.ExtractedFileData, error) {
+	r, headers, err := a.members(1, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []c.ExtractedFileData
+	names := newNamer(a.name, len(headers))
+	for i := 0; ; i++ {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		b, err := io.ReadAll(data)
+		if err != nil {
+			return files, fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
+		}
+		file := c.ExtractedFileData{Header: *h, Data: b}
+		if c.SanitizePath(h.Filename) == "" {
+			file.Filename = names.next(i)
+		}
+		files = append(files, file)
+	}
+}
+
+// namer generates names for members that have no filename, after the archive
+// they are extracted from and their index in it: DISK1_0, DISK1_1 and so on
+// for DISK1.CMZ, or just DISK1 if the archive holds a single member. A member
+// is given the same name whichever members are selected. Archives that are not
+// read from a named file use extracted_file instead.
+type namer struct {
+	base    string
+	members int // Number of members in the archive, or 0 if unknown.
+}
+
+func newNamer(archivePath string, members int) *namer {
+	base := filepath.Base(archivePath)
+	if archivePath == "" {
+		base = ""
+	}
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if base == "" {
+		base = "extracted_file"
+	}
+	return &namer{base: base, members: members}
+}
+
+// next returns the name for the nameless member at index i.
+func (nm *namer) next(i int) string {
+	if nm.members == 1 && i == 0 { // Only one file, and it's this one.
+		return nm.base // Use simpler name if only one nameless file.
+	}
+	return fmt.Sprintf("%s_%d", nm.base, i)
+}
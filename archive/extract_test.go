@@ -0,0 +1,530 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourcekris/dclextract/cmz"
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// implode returns data compressed with the DCL implode compressor.
+func implode(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := c.NewImplodeWriter(&buf, c.LiteralBinary, 1024)
+	if err != nil {
+		t.Fatalf("NewImplodeWriter: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// zarMember is a member of an archive built by zarArchive.
+type zarMember struct {
+	dir  string // Directory stored with -v, or empty.
+	name string
+	attr byte // Attribute bits stored in the high nibble of the name length.
+	data []byte
+}
+
+// zarArchive returns a ZAR archive holding members, with the given
+// configuration word. If it has the directories bit set, the table of contents
+// stores each member's directory as written by -v, sharing nothing with the
+// previous one.
+func zarArchive(t *testing.T, config uint16, members []zarMember) []byte {
+	t.Helper()
+	directories := config&0x0004 != 0
+	var data, toc []byte
+	for _, m := range members {
+		comp := implode(t, m.data)
+		data = append(data, comp...)
+		if directories {
+			toc = append(toc, 0, byte(len(m.dir)))
+			toc = append(toc, m.dir...)
+		}
+		toc = append(toc, m.attr<<4|byte(len(m.name)))
+		toc = append(toc, m.name...)
+		toc = binary.LittleEndian.AppendUint32(toc, uint32(len(comp)))
+	}
+	b := append(data, toc...)
+	b = binary.LittleEndian.AppendUint16(b, config)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(toc)))
+	return append(b, 'P', 'T', '&')
+}
+
+// member is a member of an archive built by nskArchive or tscArchive.
+type member struct {
+	name string
+	data string
+}
+
+// nskArchive returns an NSK archive holding members.
+func nskArchive(t *testing.T, members ...member) []byte {
+	t.Helper()
+	var b []byte
+	for _, m := range members {
+		comp := implode(t, []byte(m.data))
+		b = append(b, 'N', 'S', 'K')
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(comp)))
+		b = append(b, make([]byte, 5)...) // Unknown.
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(m.data)))
+		b = append(b, byte(len(m.name)))
+		b = append(b, m.name...)
+		b = append(b, comp...)
+	}
+	return b
+}
+
+// tscArchive returns a TSC archive made by version 1.2 holding members.
+func tscArchive(t *testing.T, members ...member) []byte {
+	t.Helper()
+	b := []byte{0x65, 0x5D, 0x13, 0x8C, 0x08, 1, 2, 0, '*', 0, 0, 0, 0}
+	for _, m := range members {
+		comp := implode(t, []byte(m.data))
+		h := make([]byte, 16)
+		binary.LittleEndian.PutUint32(h[1:], uint32(len(comp)))
+		h[15] = byte(len(m.name))
+		b = append(b, h...)
+		b = append(b, m.name...)
+		b = append(b, 0)
+		b = append(b, comp...)
+	}
+	return b
+}
+
+// writeFile writes data to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkFile checks that the file at path holds want.
+func checkFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("reading extracted file: %v", err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s holds %q, want %q", path, got, want)
+	}
+}
+
+func TestExtractToZARDirectories(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "DISK1.ZAR", zarArchive(t, 0x0004, []zarMember{
+		{dir: `C:\WINDOWS\`, name: "WIN.COM", data: []byte("win.com")},
+		{dir: `C:\WINDOWS\SYSTEM\`, name: "VGA.DRV", data: []byte("vga.drv")},
+		{dir: `D:\`, name: "README.TXT", data: []byte("readme")},
+	}))
+
+	out := filepath.Join(dir, "out")
+	n, err := ExtractTo(path, out, nil)
+	if err != nil {
+		t.Fatalf("ExtractTo: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("ExtractTo wrote %d files, want 3", n)
+	}
+	checkFile(t, filepath.Join(out, "WINDOWS", "WIN.COM"), []byte("win.com"))
+	checkFile(t, filepath.Join(out, "WINDOWS", "SYSTEM", "VGA.DRV"), []byte("vga.drv"))
+	checkFile(t, filepath.Join(out, "README.TXT"), []byte("readme"))
+}
+
+func TestExtractToAttributes(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "DISK1.ZAR", zarArchive(t, 0, []zarMember{
+		{name: "README.TXT", attr: 0x9, data: []byte("read-only")}, // Read-only and archive.
+		{name: "NOTES.TXT", attr: 0x8, data: []byte("archive")},
+	}))
+
+	for _, tc := range []struct {
+		name     string
+		opts     Options
+		readOnly bool // README.TXT is made read-only.
+	}{
+		{"not applied", Options{}, false},
+		{"applied", Options{ApplyAttributes: true}, true},
+		// Replacing a read-only file makes it writable first.
+		{"applied again", Options{ApplyAttributes: true}, true},
+		{"replaced without attributes", Options{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := filepath.Join(dir, "out")
+			if _, err := ExtractTo(path, out, &tc.opts); err != nil {
+				t.Fatalf("ExtractTo: %v", err)
+			}
+			for _, f := range []struct {
+				name     string
+				readOnly bool
+			}{{"README.TXT", tc.readOnly}, {"NOTES.TXT", false}} {
+				fi, err := os.Stat(filepath.Join(out, f.name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fi.Mode().Perm()&0222 == 0; got != f.readOnly {
+					t.Errorf("%s has mode %v, want read-only %v", f.name, fi.Mode(), f.readOnly)
+				}
+				if f.readOnly && fi.Mode().Perm() != 0444 {
+					t.Errorf("%s has mode %v, want %v", f.name, fi.Mode(), fs.FileMode(0444))
+				}
+			}
+		})
+	}
+}
+
+// cmzMember is a member of an archive built by cmzArchiveWith.
+type cmzMember struct {
+	name    string
+	modTime time.Time
+	data    string
+}
+
+// cmzArchiveWith returns a CMZ archive holding members.
+func cmzArchiveWith(t *testing.T, members ...cmzMember) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := cmz.NewWriter(&buf)
+	for _, m := range members {
+		mw, err := w.CreateHeader(&c.Header{Filename: m.name, ModTime: m.modTime})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q): %v", m.name, err)
+		}
+		if _, err := mw.Write([]byte(m.data)); err != nil {
+			t.Fatalf("writing %q: %v", m.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractTo(t *testing.T) {
+	stamp := time.Date(1995, time.August, 24, 10, 30, 0, 0, time.Local)
+	dir := t.TempDir()
+	path := writeFile(t, dir, "DISK1.CMZ", cmzArchiveWith(t,
+		cmzMember{name: "README.TXT", modTime: stamp, data: "readme"},
+		cmzMember{name: `DOCS\MANUAL.TXT`, data: "manual"},
+		cmzMember{name: "", data: "nameless"},
+		cmzMember{name: `..\..\ESCAPE.TXT`, data: "escape"},
+	))
+
+	var results []Result
+	out := filepath.Join(dir, "out")
+	n, err := ExtractTo(path, out, &Options{Progress: func(r *Result) { results = append(results, *r) }})
+	if err != nil {
+		t.Fatalf("ExtractTo: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("ExtractTo wrote %d files, want 4", n)
+	}
+	checkFile(t, filepath.Join(out, "README.TXT"), []byte("readme"))
+	checkFile(t, filepath.Join(out, "DOCS", "MANUAL.TXT"), []byte("manual"))
+	checkFile(t, filepath.Join(out, "DISK1_2"), []byte("nameless"))
+	checkFile(t, filepath.Join(out, "ESCAPE.TXT"), []byte("escape"))
+
+	if fi, err := os.Stat(filepath.Join(out, "README.TXT")); err != nil || !fi.ModTime().Equal(stamp) {
+		t.Errorf("README.TXT modification time = %v, %v; want %v", fi.ModTime(), err, stamp)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("Progress called %d times, want 4", len(results))
+	}
+	for i, r := range results {
+		if r.Index != i || r.Err != nil || r.Skipped != "" || r.Path == "" {
+			t.Errorf("result %d = %+v, want member %d written", i, r, i)
+		}
+	}
+	if r := results[2]; r.Name != "DISK1_2" || !r.Generated {
+		t.Errorf("nameless member named %q, generated %v; want DISK1_2, true", r.Name, r.Generated)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("manual"))); results[1].SHA256 != want || results[1].Size != 6 {
+		t.Errorf("result 1 has %d bytes with hash %s, want 6 bytes with hash %s", results[1].Size, results[1].SHA256, want)
+	}
+}
+
+func TestExtractToSelect(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "DISK1.CMZ", cmzArchiveWith(t,
+		cmzMember{name: "A.TXT", data: "a"},
+		cmzMember{name: "B.TXT", data: "b"},
+		cmzMember{name: "C.TXT", data: "c"},
+	))
+
+	var indexes []int
+	out := filepath.Join(dir, "out")
+	n, err := ExtractTo(path, out, &Options{
+		Select:   func(i int, h *c.Header) bool { return h.Filename != "B.TXT" },
+		Progress: func(r *Result) { indexes = append(indexes, r.Index) },
+	})
+	if err != nil {
+		t.Fatalf("ExtractTo: %v", err)
+	}
+	if n != 2 || fmt.Sprint(indexes) != "[0 2]" {
+		t.Errorf("ExtractTo wrote %d files with indexes %v, want 2 with [0 2]", n, indexes)
+	}
+	if _, err := os.Stat(filepath.Join(out, "B.TXT")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("B.TXT was extracted: %v", err)
+	}
+}
+
+func TestExtractToOverwrite(t *testing.T) {
+	existing := time.Date(2000, time.January, 1, 12, 0, 0, 0, time.Local)
+	older, newer := existing.Add(-time.Hour), existing.Add(time.Hour)
+
+	for _, tc := range []struct {
+		policy  OverwritePolicy
+		modTime time.Time // Of the member; zero if it has none.
+		want    string    // Contents of README.TXT afterwards.
+		renamed bool      // The member is written to README_1.TXT instead.
+		skipped bool
+	}{
+		{policy: "", modTime: older, want: "new"},
+		{policy: OverwriteAlways, modTime: older, want: "new"},
+		{policy: OverwriteNever, modTime: newer, want: "old", skipped: true},
+		{policy: OverwriteRename, modTime: newer, want: "old", renamed: true},
+		{policy: OverwriteNewer, modTime: newer, want: "new"},
+		{policy: OverwriteNewer, modTime: existing, want: "old", skipped: true},
+		{policy: OverwriteNewer, modTime: older, want: "old", skipped: true},
+		{policy: OverwriteNewer, want: "old", skipped: true},
+	} {
+		t.Run(fmt.Sprintf("%s %s", tc.policy, tc.modTime.Format(time.Kitchen)), func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeFile(t, dir, "DISK1.CMZ", cmzArchiveWith(t, cmzMember{name: "README.TXT", modTime: tc.modTime, data: "new"}))
+			out := filepath.Join(dir, "out")
+			if err := os.Mkdir(out, 0755); err != nil {
+				t.Fatal(err)
+			}
+			old := writeFile(t, out, "README.TXT", []byte("old"))
+			if err := os.Chtimes(old, existing, existing); err != nil {
+				t.Fatal(err)
+			}
+
+			var res Result
+			n, err := ExtractTo(path, out, &Options{Overwrite: tc.policy, Progress: func(r *Result) { res = *r }})
+			if err != nil {
+				t.Fatalf("ExtractTo: %v", err)
+			}
+			checkFile(t, old, []byte(tc.want))
+			if got := res.Skipped != ""; got != tc.skipped || (n == 0) != tc.skipped {
+				t.Errorf("wrote %d files, skipped %q; want skipped %v", n, res.Skipped, tc.skipped)
+			}
+			renamed := filepath.Join(out, "README_1.TXT")
+			if tc.renamed {
+				checkFile(t, renamed, []byte("new"))
+				if res.Path != renamed {
+					t.Errorf("Path = %q, want %q", res.Path, renamed)
+				}
+			} else if _, err := os.Stat(renamed); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("README_1.TXT exists: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractToRenameConcurrently(t *testing.T) {
+	// Archives extracted at the same time into one directory never pick the
+	// same new name.
+	const archives = 32
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, out, "README.TXT", []byte("existing"))
+	var paths []string
+	for i := 0; i < archives; i++ {
+		paths = append(paths, writeFile(t, dir, fmt.Sprintf("DISK%d.CMZ", i), cmzArchiveWith(t, cmzMember{name: "README.TXT", data: fmt.Sprint(i)})))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, archives)
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			_, errs[i] = ExtractTo(path, out, &Options{Overwrite: OverwriteRename})
+		}(i, path)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("ExtractTo(%s): %v", paths[i], err)
+		}
+	}
+
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(out, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[string(data)] = true
+	}
+	if len(entries) != archives+1 || len(seen) != archives+1 {
+		t.Errorf("got %d files with %d distinct contents, want %d of each", len(entries), len(seen), archives+1)
+	}
+}
+
+func TestExtractConcurrently(t *testing.T) {
+	// Archives of every format are detected and extracted at the same time;
+	// run with -race to check that the format packages share no state.
+	dir := t.TempDir()
+	type want struct {
+		path   string
+		format string
+		names  []string
+		data   []string
+	}
+	var archives []want
+	for i := 0; i < 4; i++ {
+		a, b := fmt.Sprintf("A%d.TXT", i), fmt.Sprintf("B%d.TXT", i)
+		ad, bd := strings.Repeat("first member "+a, 20), strings.Repeat("second member "+b, 30)
+		for _, f := range []struct {
+			format string
+			data   []byte
+		}{
+			{"CMZ", cmzArchiveWith(t, cmzMember{name: a, data: ad}, cmzMember{name: b, data: bd})},
+			{"NSK", nskArchive(t, member{a, ad}, member{b, bd})},
+			{"TSC", tscArchive(t, member{a, ad}, member{b, bd})},
+			{"ZAR", zarArchive(t, 0, []zarMember{{name: a, data: []byte(ad)}, {name: b, data: []byte(bd)}})},
+		} {
+			path := writeFile(t, dir, fmt.Sprintf("DISK%d.%s", i, f.format), f.data)
+			archives = append(archives, want{path, f.format, []string{a, b}, []string{ad, bd}})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for round := 0; round < 4; round++ {
+		for _, w := range archives {
+			wg.Add(1)
+			go func(w want) {
+				defer wg.Done()
+				a, err := Open(w.path)
+				if err != nil {
+					t.Errorf("Open(%s): %v", w.path, err)
+					return
+				}
+				defer a.Close()
+				if a.Format.Name() != w.format {
+					t.Errorf("%s detected as %s, want %s", w.path, a.Format.Name(), w.format)
+				}
+				files, err := a.Extract()
+				if err != nil {
+					t.Errorf("Extract(%s): %v", w.path, err)
+					return
+				}
+				if len(files) != len(w.names) {
+					t.Errorf("Extract(%s) returned %d members, want %d", w.path, len(files), len(w.names))
+					return
+				}
+				for i, f := range files {
+					if f.Filename != w.names[i] || string(f.Data) != w.data[i] {
+						t.Errorf("%s member %d = %s with %d bytes, want %s with %d", w.path, i, f.Filename, len(f.Data), w.names[i], len(w.data[i]))
+					}
+				}
+			}(w)
+		}
+	}
+	wg.Wait()
+}
+
+func TestOverwritePolicySet(t *testing.T) {
+	var p OverwritePolicy
+	for _, s := range []string{"never", "always", "rename", "newer"} {
+		if err := p.Set(s); err != nil || string(p) != s {
+			t.Errorf("Set(%q) = %v, policy %q", s, err, p)
+		}
+	}
+	if err := p.Set("sometimes"); err == nil {
+		t.Errorf("Set(%q) succeeded", "sometimes")
+	}
+}
+
+func TestNamer(t *testing.T) {
+	for _, tc := range []struct {
+		archive string
+		members int
+		indexes []int // Of the nameless members.
+		want    []string
+	}{
+		{"DISK1.CMZ", 1, []int{0}, []string{"DISK1"}},
+		{"DISK1.CMZ", 3, []int{0, 2}, []string{"DISK1_0", "DISK1_2"}},
+		{"DISK1.CMZ", 3, []int{2}, []string{"DISK1_2"}},
+		{"DISK1.CMZ", 2, []int{1}, []string{"DISK1_1"}},
+		{"DISK1.CMZ", 0, []int{0}, []string{"DISK1_0"}}, // Number of members unknown.
+		{filepath.Join("a", "b", "DATA"), 1, []int{0}, []string{"DATA"}},
+		{"", 2, []int{0, 1}, []string{"extracted_file_0", "extracted_file_1"}},
+		{"", 1, []int{0}, []string{"extracted_file"}},
+	} {
+		nm := newNamer(tc.archive, tc.members)
+		var got []string
+		for _, i := range tc.indexes {
+			got = append(got, nm.next(i))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("names for %q with %d members = %q, want %q", tc.archive, tc.members, got, tc.want)
+		}
+	}
+}
+
+func TestExtractToSelectNameless(t *testing.T) {
+	// A selected nameless member is named as in a full extraction, so that it
+	// does not take the name of another member.
+	dir := t.TempDir()
+	path := writeFile(t, dir, "DISK1.CMZ", cmzArchiveWith(t,
+		cmzMember{data: "first"},
+		cmzMember{data: "second"},
+		cmzMember{data: "third"},
+	))
+	all := filepath.Join(dir, "all")
+	if _, err := ExtractTo(path, all, nil); err != nil {
+		t.Fatalf("ExtractTo: %v", err)
+	}
+	one := filepath.Join(dir, "one")
+	if _, err := ExtractTo(path, one, &Options{Select: func(i int, h *c.Header) bool { return i == 1 }}); err != nil {
+		t.Fatalf("ExtractTo: %v", err)
+	}
+	checkFile(t, filepath.Join(all, "DISK1_1"), []byte("second"))
+	checkFile(t, filepath.Join(one, "DISK1_1"), []byte("second"))
+	if entries, err := os.ReadDir(one); err != nil || len(entries) != 1 {
+		t.Errorf("selected extraction wrote %v, %v; want DISK1_1 alone", entries, err)
+	}
+}
+
+func TestExtractSingleNamelessMember(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "DISK1.CMZ", cmzArchiveWith(t, cmzMember{data: "data"}))
+	files, err := Extract(path)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(files) != 1 || files[0].Filename != "DISK1" || string(files[0].Data) != "data" {
+		t.Errorf("Extract = %+v, want DISK1 holding %q", files, "data")
+	}
+}
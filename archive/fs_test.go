@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sourcekris/dclextract/cmz"
+)
+
+// cmzArchive returns a CMZ archive with a member for each name, holding
+// "contents of " and the name.
+func cmzArchive(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := cmz.NewWriter(&buf)
+	for _, name := range names {
+		mw, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Create(%q): %v", name, err)
+		}
+		if _, err := mw.Write([]byte("contents of " + name)); err != nil {
+			t.Fatalf("writing %q: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenFS(t *testing.T) {
+	zarMembers := []zarMember{
+		{dir: `C:\WINDOWS\`, name: "WIN.COM", data: []byte("win.com")},
+		{dir: `C:\WINDOWS\SYSTEM\`, name: "VGA.DRV", data: []byte("vga.drv")},
+		{dir: `C:\`, name: "AUTOEXEC.BAT", data: []byte("autoexec.bat")},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		path  func(t *testing.T, dir string) string
+		files []string
+	}{
+		{
+			name: "CMZ",
+			path: func(t *testing.T, dir string) string {
+				return writeFile(t, dir, "DISK1.CMZ", cmzArchive(t, "README.TXT", `DOCS\MANUAL.TXT`, "", ""))
+			},
+			files: []string{"README.TXT", "DOCS/MANUAL.TXT", "DISK1_2", "DISK1_3"},
+		},
+		{
+			name: "single nameless member",
+			path: func(t *testing.T, dir string) string {
+				return writeFile(t, dir, "DISK1.CMZ", cmzArchive(t, ""))
+			},
+			files: []string{"DISK1"},
+		},
+		{
+			name: "ZAR",
+			path: func(t *testing.T, dir string) string {
+				return writeFile(t, dir, "DISK1.ZAR", zarArchive(t, 0x0004, zarMembers))
+			},
+			files: []string{"WINDOWS/WIN.COM", "WINDOWS/SYSTEM/VGA.DRV", "AUTOEXEC.BAT"},
+		},
+		{
+			name: "ZAR volume set",
+			path: func(t *testing.T, dir string) string {
+				data := zarArchive(t, 0x0084, zarMembers)
+				paths := writeVolumes(t, dir, data, 10, 25, len(data)-12)
+				return paths[len(paths)-1]
+			},
+			files: []string{"WINDOWS/WIN.COM", "WINDOWS/SYSTEM/VGA.DRV", "AUTOEXEC.BAT"},
+		},
+		{
+			name: "ZAR volume set from the first volume",
+			path: func(t *testing.T, dir string) string {
+				data := zarArchive(t, 0x0084, zarMembers)
+				return writeVolumes(t, dir, data, 10, 25, len(data)-12)[0]
+			},
+			files: []string{"WINDOWS/WIN.COM", "WINDOWS/SYSTEM/VGA.DRV", "AUTOEXEC.BAT"},
+		},
+		{
+			name: "ZAR volume set from a middle volume",
+			path: func(t *testing.T, dir string) string {
+				data := zarArchive(t, 0x0084, zarMembers)
+				return writeVolumes(t, dir, data, 10, 25, len(data)-12)[2]
+			},
+			files: []string{"WINDOWS/WIN.COM", "WINDOWS/SYSTEM/VGA.DRV", "AUTOEXEC.BAT"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := tc.path(t, dir)
+			fsys, err := OpenFS(path)
+			if err != nil {
+				t.Fatalf("OpenFS: %v", err)
+			}
+			defer fsys.Close()
+			if err := fstest.TestFS(fsys, tc.files...); err != nil {
+				t.Fatal(err)
+			}
+
+			// Every file holds what extraction writes at the same path.
+			out := filepath.Join(dir, "out")
+			if _, err := ExtractTo(path, out, nil); err != nil {
+				t.Fatalf("ExtractTo: %v", err)
+			}
+			for _, name := range tc.files {
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Errorf("ReadFile: %v", err)
+					continue
+				}
+				checkFile(t, filepath.Join(out, filepath.FromSlash(name)), data)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy controls what happens when an extracted file already exists.
+// The zero value is OverwriteAlways.
+type OverwritePolicy string
+
+const (
+	OverwriteAlways OverwritePolicy = "always" // Replace the existing file.
+	OverwriteNever  OverwritePolicy = "never"  // Keep the existing file and skip the member.
+	OverwriteRename OverwritePolicy = "rename" // Write the member under a new numbered name.
+	OverwriteNewer  OverwritePolicy = "newer"  // Replace only if the member's timestamp is newer.
+)
+
+// String implements flag.Value.
+func (p *OverwritePolicy) String() string { return string(*p) }
+
+// Set implements flag.Value.
+func (p *OverwritePolicy) Set(s string) error {
+	switch v := OverwritePolicy(s); v {
+	case OverwriteAlways, OverwriteNever, OverwriteRename, OverwriteNewer:
+		*p = v
+		return nil
+	}
+	return fmt.Errorf("must be one of %s, %s, %s or %s", OverwriteNever, OverwriteAlways, OverwriteRename, OverwriteNewer)
+}
+
+// resolve applies the policy to dest, returning the path to write the
+// member to, or skip set with the reason if the member should not be written.
+// modTime is the member's stored timestamp and may be zero if unknown.
+//
+// Except under OverwriteAlways, the returned path is created empty before it
+// is returned, so that archives extracted concurrently into the same
+// directory never pick the same name.
+func (p OverwritePolicy) resolve(dest string, modTime time.Time) (path string, skip string, err error) {
+	if p != "" && p != OverwriteAlways {
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return "", "", err
+		}
+		err := createNew(dest)
+		if err == nil {
+			return dest, "", nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", "", err
+		}
+	}
+
+	fi, err := os.Stat(dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return dest, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	switch p {
+	case OverwriteNever:
+		return "", "file exists", nil
+	case OverwriteRename:
+		return nextFreeName(dest)
+	case OverwriteNewer:
+		if modTime.IsZero() {
+			return "", "file exists and member has no timestamp", nil
+		}
+		if !modTime.After(fi.ModTime()) {
+			return "", "existing file is not older", nil
+		}
+	}
+	return dest, "", nil
+}
+
+// nextFreeName creates and returns the first name of the form base_N.ext
+// that does not exist.
+func nextFreeName(dest string) (string, string, error) {
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, n, ext)
+		err := createNew(candidate)
+		if err == nil {
+			return candidate, "", nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", "", err
+		}
+	}
+}
+
+// createNew creates an empty file at path, failing with fs.ErrExist if it
+// already exists.
+func createNew(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
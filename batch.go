@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcekris/dclextract/archive"
+)
+
+// batch processes many archives in one run, extracting each into its own
+// subdirectory of outputDir.
+type batch struct {
+	listMode  bool
+	testMode  bool
+	outputDir string
+	extractor extractor // Settings copied into the extractor for each archive.
+	jobs      int       // Number of archives processed concurrently.
+	sel       *selection
+}
+
+// batchArchive is an archive found for a batch run.
+type batchArchive struct {
+	path   string
+	subdir string // Subdirectory of the output directory to extract into.
+}
+
+// batchResult is the outcome of processing one archive of a batch.
+type batchResult struct {
+	output []byte // Everything the archive reported, written out in order.
+	err    error
+}
+
+// run processes every archive named by paths. Directories are searched for
+// archives if recursive is set, and files in them that are not archives are
+// skipped silently. Up to b.jobs archives are processed at once, but their
+// output is written in order. All archives are processed even if some fail;
+// the first error is returned at the end.
+func (b *batch) run(paths []string, recursive bool) error {
+	archives, err := findArchives(paths, recursive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return err
+	}
+
+	results := make([]chan batchResult, len(archives))
+	for i := range results {
+		results[i] = make(chan batchResult, 1)
+	}
+	work := make(chan int)
+	for w := 0; w < max(b.jobs, 1); w++ {
+		go func() {
+			for i := range work {
+				var buf bytes.Buffer
+				err := b.process(console.buffer(&buf), archives[i])
+				results[i] <- batchResult{output: buf.Bytes(), err: err}
+			}
+		}()
+	}
+	go func() {
+		for i := range archives {
+			work <- i
+		}
+		close(work)
+	}()
+
+	var (
+		failed   []string
+		firstErr error
+	)
+	for i, a := range archives {
+		r := <-results[i]
+		console.printf("\n==> %s <==\n", a.path)
+		console.Write(r.output)
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", a.path, r.err))
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		}
+	}
+
+	console.record(&batchRecord{Type: "batch", Archives: len(archives), Succeeded: len(archives) - len(failed), Failed: len(failed)})
+	console.printf("\nProcessed %d archive(s): %d succeeded, %d failed.\n", len(archives), len(archives)-len(failed), len(failed))
+	for _, f := range failed {
+		console.printf("  FAILED %s\n", f)
+	}
+	return firstErr
+}
+
+// process runs the selected mode on a single archive, reporting to out. Any
+// error is written to standard error, tagged with the archive path, as well
+// as returned.
+func (b *batch) process(out *reporter, a batchArchive) error {
+	switch {
+	case b.listMode:
+		err := list(out, a.path, b.sel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing %s: %v\n", a.path, err)
+		}
+		return err
+
+	case b.testMode:
+		failures, err := test(out, a.path, b.sel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error testing %s: %v\n", a.path, err)
+			return err
+		}
+		if len(failures) > 0 {
+			return failures[0]
+		}
+		return nil
+	}
+
+	x := b.extractor
+	x.outputDir = filepath.Join(b.outputDir, a.subdir)
+	written, err := x.extract(out, a.path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error extracting %s: %v\n", a.path, err)
+		return err
+	}
+	if written == 0 && x.skipped == 0 {
+		out.printf("No files found to extract from the archive.\n")
+	}
+	return nil
+}
+
+// isBatch reports whether args name several archives to process in batch
+// mode, rather than one archive followed by member patterns. That is the case
+// if directories are searched, the first argument is a directory, or every
+// argument after the first is a directory or an archive.
+func isBatch(args []string, recursive bool) bool {
+	if recursive {
+		return true
+	}
+	if fi, err := os.Stat(args[0]); err == nil && fi.IsDir() {
+		return true
+	}
+	for _, arg := range args[1:] {
+		fi, err := os.Stat(arg)
+		if err != nil || !(fi.IsDir() || isArchive(arg)) {
+			return false
+		}
+	}
+	return len(args) > 1
+}
+
+// withoutVolumes returns args without the arguments after the first that are
+// other volumes of the spanned archive named by the first, so that the volumes
+// of a set can be passed explicitly rather than being read as member patterns.
+// The first argument is replaced by the last volume, so that a set is
+// reported under the same name whichever of its volumes is given.
+func withoutVolumes(args []string) []string {
+	volumes := archiveVolumes(args[0])
+	if len(volumes) < 2 {
+		return args
+	}
+	inSet := map[string]bool{}
+	for _, v := range volumes {
+		inSet[filepath.Clean(v)] = true
+	}
+	rest := []string{volumes[len(volumes)-1]}
+	for _, arg := range args[1:] {
+		if !inSet[filepath.Clean(arg)] {
+			rest = append(rest, arg)
+		}
+	}
+	return rest
+}
+
+// findArchives returns the archives named by paths, in order. Files are
+// always included. Directories are walked if recursive is set, keeping only
+// the files that are recognized as archives. Each archive is given a distinct
+// subdirectory named after it, below the path of the directory it was found
+// in relative to the walked directory. A spanned archive is added once, under
+// its last volume, which holds the table of contents.
+func findArchives(paths []string, recursive bool) ([]batchArchive, error) {
+	var archives []batchArchive
+	used := map[string]bool{}
+	seen := map[string]bool{} // Volumes of the spanned archives added so far.
+	add := func(path, rel string, volumes []string) {
+		if seen[filepath.Clean(path)] {
+			return
+		}
+		for _, v := range volumes {
+			seen[filepath.Clean(v)] = true
+		}
+		if len(volumes) > 1 {
+			path = volumes[len(volumes)-1]
+		}
+		subdir := strings.TrimSuffix(rel, filepath.Ext(rel))
+		if subdir == rel {
+			subdir += "_files"
+		}
+		for n := 1; used[strings.ToLower(subdir)]; n++ {
+			subdir = fmt.Sprintf("%s_%d", strings.TrimSuffix(rel, filepath.Ext(rel)), n)
+		}
+		used[strings.ToLower(subdir)] = true
+		archives = append(archives, batchArchive{path: path, subdir: subdir})
+	}
+
+	for _, root := range paths {
+		fi, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			volumes := archiveVolumes(root)
+			rel := root
+			if len(volumes) > 1 {
+				rel = volumes[len(volumes)-1]
+			}
+			add(root, filepath.Base(rel), volumes)
+			continue
+		}
+		if !recursive {
+			return nil, fmt.Errorf("%s is a directory (use -r to search it for archives)", root)
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			volumes := archiveVolumes(path)
+			if volumes == nil {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			add(path, rel, volumes)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return archives, nil
+}
+
+// isArchive reports whether the file at path is recognized as an archive, or
+// as a volume of a spanned archive.
+func isArchive(path string) bool {
+	return archiveVolumes(path) != nil
+}
+
+// archiveVolumes returns the files that the archive at path is stored in: all
+// volumes of a spanned ZAR archive if path is any of them, or path alone. It
+// returns nil if path is not recognized as an archive.
+func archiveVolumes(path string) []string {
+	a, err := archive.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer a.Close()
+	return a.Paths
+}
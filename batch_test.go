@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// spannedArchive writes a ZAR archive holding members to FOO.ZA1 and FOO.ZA2
+// in dir and returns their paths.
+func spannedArchive(t *testing.T, dir string, members ...zarMember) []string {
+	t.Helper()
+	data := zarArchive(t, 0x0080, members...)
+	return []string{
+		writeFile(t, dir, "FOO.ZA1", data[:10]),
+		writeFile(t, dir, "FOO.ZA2", data[10:]),
+	}
+}
+
+// batchTree writes archives and other files below a new directory and returns
+// its path.
+func batchTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, root, "A.CMZ", cmzArchive(t, "A.TXT"))
+	writeFile(t, root, "a.zar", zarArchive(t, 0, zarMember{name: "Z.TXT"}))
+	writeFile(t, root, "DATA", cmzArchive(t, "D.TXT"))
+	writeFile(t, root, "NOTES.TXT", []byte("Some notes about the release, in plain text.\r\n"))
+	writeFile(t, root, filepath.Join("sub", "A.CMZ"), cmzArchive(t, "B.TXT"))
+	spannedArchive(t, filepath.Join(root, "set"), zarMember{name: "S.TXT"})
+	return root
+}
+
+func TestFindArchives(t *testing.T) {
+	root := batchTree(t)
+	got, err := findArchives([]string{root}, true)
+	if err != nil {
+		t.Fatalf("findArchives: %v", err)
+	}
+	want := []batchArchive{
+		{path: filepath.Join(root, "A.CMZ"), subdir: "A"},
+		{path: filepath.Join(root, "DATA"), subdir: "DATA_files"},
+		{path: filepath.Join(root, "a.zar"), subdir: "a_1"}, // Named apart from A.CMZ without regard to case.
+		{path: filepath.Join(root, "set", "FOO.ZA2"), subdir: filepath.Join("set", "FOO")},
+		{path: filepath.Join(root, "sub", "A.CMZ"), subdir: filepath.Join("sub", "A")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findArchives =\n%v\nwant\n%v", got, want)
+	}
+
+	// Files named explicitly are always included, and a spanned archive is
+	// added once whichever of its volumes are named.
+	set := filepath.Join(root, "set")
+	got, err = findArchives([]string{filepath.Join(root, "NOTES.TXT"), filepath.Join(set, "FOO.ZA1"), filepath.Join(set, "FOO.ZA2")}, false)
+	if err != nil {
+		t.Fatalf("findArchives: %v", err)
+	}
+	want = []batchArchive{
+		{path: filepath.Join(root, "NOTES.TXT"), subdir: "NOTES"},
+		{path: filepath.Join(set, "FOO.ZA2"), subdir: "FOO"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findArchives of files =\n%v\nwant\n%v", got, want)
+	}
+
+	if _, err := findArchives([]string{root}, false); err == nil {
+		t.Errorf("findArchives of a directory without recursion succeeded")
+	}
+	if _, err := findArchives([]string{filepath.Join(root, "MISSING.CMZ")}, false); err == nil {
+		t.Errorf("findArchives of a missing file succeeded")
+	}
+}
+
+func TestIsBatch(t *testing.T) {
+	root := batchTree(t)
+	in := func(name string) string { return filepath.Join(root, name) }
+	for _, tc := range []struct {
+		args      []string
+		recursive bool
+		want      bool
+	}{
+		{[]string{in("A.CMZ")}, false, false},
+		{[]string{in("A.CMZ")}, true, true},
+		{[]string{root}, false, true},
+		{[]string{in("A.CMZ"), in("a.zar")}, false, true},
+		{[]string{in("A.CMZ"), in("sub")}, false, true},
+		{[]string{in("A.CMZ"), "*.TXT"}, false, false},
+		{[]string{in("A.CMZ"), in("NOTES.TXT")}, false, false},
+		{[]string{in("A.CMZ"), in("a.zar"), "A.TXT"}, false, false},
+	} {
+		if got := isBatch(tc.args, tc.recursive); got != tc.want {
+			t.Errorf("isBatch(%q, %v) = %v, want %v", tc.args, tc.recursive, got, tc.want)
+		}
+	}
+}
+
+func TestWithoutVolumes(t *testing.T) {
+	paths := spannedArchive(t, t.TempDir(), zarMember{name: "S.TXT"})
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{paths[0]}, []string{paths[1]}},
+		{[]string{paths[1]}, []string{paths[1]}},
+		{[]string{paths[0], paths[1], "*.TXT"}, []string{paths[1], "*.TXT"}},
+		{[]string{paths[1], paths[0]}, []string{paths[1]}},
+		{[]string{"*.TXT", paths[0]}, []string{"*.TXT", paths[0]}},
+	} {
+		if got := withoutVolumes(tc.args); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("withoutVolumes(%q) = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestBatchRun(t *testing.T) {
+	root := batchTree(t)
+	bad := cmzArchive(t, "X.TXT")
+	writeFile(t, root, filepath.Join("sub", "BAD.CMZ"), bad[:len(bad)-4])
+	out := t.TempDir()
+
+	stdout, stderr, status := runCLI(t, root, "-r", "-d", out, ".")
+	if status != exitTruncated {
+		t.Errorf("exit status %d, want %d; stderr:\n%s", status, exitTruncated, stderr)
+	}
+
+	// Each archive's output follows a header naming it, in the order found.
+	var headers []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.HasPrefix(line, "==> ") {
+			headers = append(headers, line)
+		}
+	}
+	want := []string{"==> A.CMZ <==", "==> DATA <==", "==> a.zar <==", "==> " + filepath.Join("set", "FOO.ZA2") + " <==", "==> " + filepath.Join("sub", "A.CMZ") + " <==", "==> " + filepath.Join("sub", "BAD.CMZ") + " <=="}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("archive headers = %q, want %q", headers, want)
+	}
+	if !strings.Contains(stdout, "Processed 6 archive(s): 5 succeeded, 1 failed.\n  FAILED "+filepath.Join("sub", "BAD.CMZ")+": ") {
+		t.Errorf("summary missing from output:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "Error extracting "+filepath.Join("sub", "BAD.CMZ")) {
+		t.Errorf("error not tagged with the archive:\n%s", stderr)
+	}
+
+	for _, f := range []string{
+		filepath.Join("A", "A.TXT"),
+		filepath.Join("DATA_files", "D.TXT"),
+		filepath.Join("a_1", "Z.TXT"),
+		filepath.Join("set", "FOO", "S.TXT"),
+		filepath.Join("sub", "A", "B.TXT"),
+	} {
+		data, err := os.ReadFile(filepath.Join(out, f))
+		if err != nil {
+			t.Errorf("reading extracted file: %v", err)
+			continue
+		}
+		if want := contents(filepath.Base(f)); string(data) != want {
+			t.Errorf("%s holds %q, want %q", f, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "NOTES")); !os.IsNotExist(err) {
+		t.Errorf("NOTES.TXT was treated as an archive: %v", err)
+	}
+}
+
+func TestBatchJobs(t *testing.T) {
+	// The output of archives processed at once is written one archive at a
+	// time, in the order they were found.
+	root := t.TempDir()
+	var names []string
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("M%02d.TXT", i)
+		writeFile(t, root, fmt.Sprintf("ARC%02d.CMZ", i), cmzArchive(t, name, "COMMON.TXT"))
+		names = append(names, name)
+	}
+
+	stdout, stderr, status := runCLI(t, root, "-j", "4", "-d", "out", "-r", ".")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	blocks := strings.Split(stdout, "\n==> ")[1:]
+	if len(blocks) != len(names) {
+		t.Fatalf("got %d archive blocks, want %d:\n%s", len(blocks), len(names), stdout)
+	}
+	for i, block := range blocks {
+		if want := fmt.Sprintf("ARC%02d.CMZ <==\n", i); !strings.HasPrefix(block, want) {
+			t.Errorf("block %d starts %q, want %q", i, strings.SplitN(block, "\n", 2)[0], want)
+		}
+		for j, name := range names {
+			if got := strings.Contains(block, "Successfully extracted "+name); got != (i == j) {
+				t.Errorf("block %d reports %s: %v, want %v", i, name, got, i == j)
+			}
+		}
+		if n := strings.Count(block, "Successfully extracted COMMON.TXT"); n != 1 {
+			t.Errorf("block %d reports COMMON.TXT %d times, want once", i, n)
+		}
+	}
+	for i, name := range names {
+		data, err := os.ReadFile(filepath.Join(root, "out", fmt.Sprintf("ARC%02d", i), name))
+		if err != nil || string(data) != contents(name) {
+			t.Errorf("extracted %s = %q, %v; want %q", name, data, err, contents(name))
+		}
+	}
+
+	// JSON records of each archive stay together.
+	stdout, stderr, status = runCLI(t, root, "-j", "4", "-json", "-l", "-r", ".")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	records := decodeRecords(t, bytes.NewBufferString(stdout))
+	if len(records) != 3*len(names)+1 {
+		t.Fatalf("got %d records, want %d", len(records), 3*len(names)+1)
+	}
+	for i := range names {
+		archive := fmt.Sprintf("ARC%02d.CMZ", i)
+		for j, typ := range []string{"member", "member", "summary"} {
+			checkRecord(t, records[3*i+j], map[string]any{"type": typ, "archive": archive})
+		}
+		checkRecord(t, records[3*i], map[string]any{"name": names[i]})
+	}
+	checkRecord(t, records[len(records)-1], map[string]any{"type": "batch", "archives": len(names), "succeeded": len(names), "failed": 0})
+}
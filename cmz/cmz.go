@@ -2,80 +2,231 @@
 package cmz
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 
 	c "github.com/sourcekris/dclextract/common"
 )
 
-func readCMZMemberMetadata(rs io.Reader) (compSize, decompSize uint32, fnSize int, err error) {
+func init() {
+	c.Register(c.TypeCMZ, format{})
+}
+
+// format implements c.Format for CMZ archives.
+type format struct{}
+
+func (format) Name() string      { return "CMZ" }
+func (format) Signature() []byte { return c.Signatures[c.TypeCMZ] }
+
+func (format) Match(header, footer []byte) bool {
+	return bytes.HasPrefix(header, c.Signatures[c.TypeCMZ])
+}
+
+func (format) List(rs io.ReadSeeker) ([]c.Header, error) {
+	return List(rs)
+}
+
+func (format) NewReader(rs io.ReadSeeker) c.MemberReader {
+	return NewReader(rs)
+}
+
+func (format) NewStreamReader(r io.Reader) c.MemberReader {
+	return NewStreamReader(r)
+}
+
+func (format) NewWriter(w io.Writer, mode c.LiteralMode, dictSize int) c.ArchiveWriter {
+	cw := NewWriter(w)
+	cw.Mode, cw.DictSize = mode, dictSize
+	return cw
+}
+
+func (format) Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	return Extract(rs)
+}
+
+// Probe checks the signature and the first member of a CMZ archive. The
+// member is checked even if the signature is damaged.
+func (format) Probe(rs io.ReadSeeker) c.Candidate {
+	sig := c.Signatures[c.TypeCMZ]
+	return c.ProbeArchive(rs, sig, int64(len(sig)), func(rs io.ReadSeeker) (*c.Header, error) {
+		return readMemberFields(rs, 0, 0)
+	})
+}
+
+// readCMZMemberMetadata reads the 16-byte metadata block for a CMZ member.
+// Metadata structure: compSize (4), decompSize (4), DOS date (2), DOS time (2),
+// fnSize (1), unknown (3)
+func readCMZMemberMetadata(rs io.Reader) (compSize, decompSize uint32, modTime time.Time, fnSize int, err error) {
 	metadata := make([]byte, 16)
 	if _, err = io.ReadFull(rs, metadata); err != nil {
-		return 0, 0, 0, fmt.Errorf("reading metadata: %w", err)
+		return 0, 0, time.Time{}, 0, fmt.Errorf("reading metadata: %w", err)
 	}
 
 	compSize = binary.LittleEndian.Uint32(metadata[0:4])
 	decompSize = binary.LittleEndian.Uint32(metadata[4:8])
+	modTime, err = c.ReadDOSModifiedTimeStamp(bytes.NewReader(metadata[8:12]))
+	if err != nil {
+		return 0, 0, time.Time{}, 0, err
+	}
 	fnSize = int(metadata[12])
 
 	if fnSize < 0 {
-		return 0, 0, 0, fmt.Errorf("invalid filename size %d", fnSize)
+		return 0, 0, time.Time{}, 0, fmt.Errorf("invalid filename size %d", fnSize)
 	}
-	return compSize, decompSize, fnSize, nil
+	return compSize, decompSize, modTime, fnSize, nil
 }
 
-// Extract reads and extracts files from a CMZ archive.
-func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
-	var allFiles []c.ExtractedFileData
-	processedAnyFile := false
+// formatError returns a *c.FormatError of the given kind for the member'th
+// member of a CMZ archive.
+func formatError(member int, offset int64, kind error, format string, args ...any) error {
+	return c.NewFormatError("CMZ", member, offset, kind, fmt.Errorf(format, args...))
+}
+
+// readMemberHeader reads the header of the member'th member, leaving rs
+// positioned at the start of its compressed data. It returns io.EOF if the
+// archive ends cleanly before the header.
+func readMemberHeader(rs io.ReadSeeker, member int) (*c.Header, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("CMZ: getting member header offset: %w", err)
+	}
+
+	// 1. Read Magic (4 bytes)
+	br, err := c.ReadFileMagic(rs, c.Signatures[c.TypeCMZ])
+	if err != nil {
+		// If we read 0 bytes and have processed files, it's a clean end.
+		if br == 0 && member > 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, formatError(member, start, c.ErrBadMagic, "reading member magic: %w", err)
+	}
+
+	return readMemberFields(rs, member, start)
+}
+
+// readMemberFields reads the metadata and filename that follow the magic of
+// the member'th member, whose header starts at start, leaving rs positioned at
+// the start of its compressed data.
+func readMemberFields(rs io.ReadSeeker, member int, start int64) (*c.Header, error) {
+	// 2. Read Metadata
+	compSize, decompSize, modTime, fnSize, err := readCMZMemberMetadata(rs)
+	if err != nil {
+		return nil, formatError(member, start, c.ErrCorruptHeader, "reading member metadata: %w", err)
+	}
 
+	// 3. Read Filename
+	originalFilename, err := c.ReadFilename(rs, fnSize)
+	if err != nil {
+		return nil, formatError(member, start, c.ErrCorruptHeader, "reading member filename: %w", err)
+	}
+
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("CMZ: getting member data offset: %w", err)
+	}
+
+	return &c.Header{
+		Filename:         originalFilename,
+		CompressedSize:   compSize,
+		DecompressedSize: decompSize,
+		ModTime:          modTime,
+		Offset:           offset,
+	}, nil
+}
+
+// List reads the member headers of a CMZ archive, seeking over the compressed data.
+func List(rs io.ReadSeeker) ([]c.Header, error) {
+	size, err := c.ArchiveSize(rs)
+	if err != nil {
+		return nil, fmt.Errorf("CMZ: could not determine archive size: %w", err)
+	}
+
+	var headers []c.Header
 	for {
-		// 1. Read Magic (4 bytes)
-		br, err := c.ReadFileMagic(rs, c.Signatures[c.TypeCMZ])
+		h, err := readMemberHeader(rs, len(headers))
+		if err == io.EOF {
+			return headers, nil
+		}
 		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				// If we read 0 bytes and have processed files, it's a clean end.
-				if br == 0 && processedAnyFile && err == io.EOF {
-					return allFiles, nil
-				}
-				// Otherwise, it's an unexpected end or an empty file on first try.
-				if processedAnyFile {
-					return allFiles, fmt.Errorf("CMZ: unexpected end of archive while expecting next member header: %w", err)
-				}
-				// Error on the very first attempt to read a member (or magic mismatch)
-				return allFiles, fmt.Errorf("CMZ: failed to read member header: %w", err)
-			}
-			// Other I/O error
-			return allFiles, fmt.Errorf("CMZ: error reading member magic: %w", err)
+			return headers, err
+		}
+		if err := c.SkipData(rs, h.Offset, h.CompressedSize, size); err != nil {
+			return headers, formatError(len(headers), h.Offset, c.ErrTruncated, "member '%s': %w", h.Filename, err)
 		}
-		// At this point, br should be len(expectedMagic) and err is nil
-		processedAnyFile = true
+		headers = append(headers, *h)
+	}
+}
 
-		// 2. Read Metadata
-		compSize, decompSize, fnSize, err := readCMZMemberMetadata(rs)
-		if err != nil {
-			return allFiles, fmt.Errorf("CMZ: reading member metadata: %w", err)
+// Reader provides sequential access to the members of a CMZ archive.
+type Reader struct {
+	rs   io.ReadSeeker
+	n    int   // Number of members read so far.
+	next int64 // Offset of the next member header.
+	err  error // Sticky error.
+}
+
+// NewReader returns a Reader that reads members from rs, starting at its
+// current position.
+func NewReader(rs io.ReadSeeker) *Reader {
+	return &Reader{rs: rs}
+}
+
+// NewStreamReader returns a Reader that reads members from r, which need not
+// support seeking. The data of each member is discarded if it is not read.
+func NewStreamReader(r io.Reader) *Reader {
+	return NewReader(c.NewForwardReader(r))
+}
+
+// Next advances to the next member and returns its header and a reader for
+// its decompressed data. It returns io.EOF once there are no more members.
+func (r *Reader) Next() (*c.Header, io.Reader, error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if r.n > 0 {
+		// Skip any unread data of the previous member.
+		if _, err := r.rs.Seek(r.next, io.SeekStart); err != nil {
+			r.err = fmt.Errorf("CMZ: seeking to next member: %w", err)
+			return nil, nil, r.err
 		}
+	}
+
+	h, err := readMemberHeader(r.rs, r.n)
+	if err != nil {
+		r.err = err
+		return nil, nil, err
+	}
+	r.n++
+	r.next = h.Offset + int64(h.CompressedSize)
 
-		// 3. Read Filename
-		originalFilename, err := c.ReadFilename(rs, fnSize)
+	return h, c.NewMemberReader(r.rs, "CMZ", r.n-1, h), nil
+}
+
+// Extract reads and extracts files from a CMZ archive.
+func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	var allFiles []c.ExtractedFileData
+
+	r := NewReader(rs)
+	for {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			return allFiles, nil
+		}
 		if err != nil {
-			return allFiles, fmt.Errorf("CMZ: reading member filename: %w", err)
+			return allFiles, err
 		}
 
-		// 4. Read Compressed Data & Decompress
-		limitedDataReader := io.LimitReader(rs, int64(compSize))
-		decompressedData, err := c.ReadAndDecompressBlastData(limitedDataReader, compSize, decompSize)
+		decompressedData, err := io.ReadAll(data)
 		if err != nil {
-			return allFiles, fmt.Errorf("CMZ: processing data for member '%s': %w", originalFilename, err)
+			return allFiles, fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
 		}
 
 		allFiles = append(allFiles, c.ExtractedFileData{
-			Filename:         originalFilename,
-			Data:             decompressedData,
-			CompressedSize:   compSize,
-			DecompressedSize: decompSize,
+			Header: *h,
+			Data:   decompressedData,
 		})
 	}
 }
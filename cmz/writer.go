@@ -0,0 +1,123 @@
+package cmz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// Default compression settings for new members.
+const (
+	DefaultMode     = c.LiteralBinary
+	DefaultDictSize = 4096
+)
+
+// Writer creates CMZ archives. Each member's data is compressed in memory and
+// written out, preceded by its header, once the member is complete.
+type Writer struct {
+	// Mode and DictSize select the DCL compression used for members created
+	// after they are set.
+	Mode     c.LiteralMode
+	DictSize int
+
+	w      io.Writer
+	cur    *memberWriter
+	closed bool
+}
+
+// memberWriter compresses the data of the member being written.
+type memberWriter struct {
+	h    c.Header
+	comp bytes.Buffer
+	zw   io.WriteCloser
+	size int64 // Uncompressed bytes written.
+}
+
+func (m *memberWriter) Write(p []byte) (int, error) {
+	n, err := m.zw.Write(p)
+	m.size += int64(n)
+	return n, err
+}
+
+// NewWriter returns a Writer that writes a CMZ archive to w using the default
+// compression settings.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Mode: DefaultMode, DictSize: DefaultDictSize, w: w}
+}
+
+// Create adds a member with the given name, using the current time as its
+// modification time.
+func (w *Writer) Create(name string) (io.Writer, error) {
+	return w.CreateHeader(&c.Header{Filename: name, ModTime: time.Now()})
+}
+
+// CreateHeader adds a member described by h and returns a writer for its
+// uncompressed data. Only the filename and modification time are taken from
+// h; sizes are computed as the data is written.
+func (w *Writer) CreateHeader(h *c.Header) (io.Writer, error) {
+	if w.closed {
+		return nil, errors.New("CMZ: write to closed archive")
+	}
+	if len(h.Filename) > math.MaxUint8 {
+		return nil, fmt.Errorf("CMZ: filename %q is longer than %d bytes", h.Filename, math.MaxUint8)
+	}
+	if err := w.finishMember(); err != nil {
+		return nil, err
+	}
+
+	m := &memberWriter{h: *h}
+	zw, err := c.NewImplodeWriter(&m.comp, w.Mode, w.DictSize)
+	if err != nil {
+		return nil, fmt.Errorf("CMZ: member '%s': %w", h.Filename, err)
+	}
+	m.zw = zw
+	w.cur = m
+	return m, nil
+}
+
+// finishMember writes the member currently being built, if any.
+func (w *Writer) finishMember() error {
+	m := w.cur
+	if m == nil {
+		return nil
+	}
+	w.cur = nil
+
+	if err := m.zw.Close(); err != nil {
+		return fmt.Errorf("CMZ: compressing member '%s': %w", m.h.Filename, err)
+	}
+	if m.size > math.MaxUint32 || m.comp.Len() > math.MaxUint32 {
+		return fmt.Errorf("CMZ: member '%s' is too large", m.h.Filename)
+	}
+
+	// The metadata block mirrors readCMZMemberMetadata.
+	metadata := make([]byte, 16)
+	binary.LittleEndian.PutUint32(metadata[0:4], uint32(m.comp.Len()))
+	binary.LittleEndian.PutUint32(metadata[4:8], uint32(m.size))
+	ddate, dtime := c.DOSDateTime(m.h.ModTime)
+	binary.LittleEndian.PutUint16(metadata[8:10], ddate)
+	binary.LittleEndian.PutUint16(metadata[10:12], dtime)
+	metadata[12] = byte(len(m.h.Filename))
+
+	for _, b := range [][]byte{c.Signatures[c.TypeCMZ], metadata, []byte(m.h.Filename), m.comp.Bytes()} {
+		if _, err := w.w.Write(b); err != nil {
+			return fmt.Errorf("CMZ: writing member '%s': %w", m.h.Filename, err)
+		}
+	}
+	return nil
+}
+
+// Close writes the last member. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.finishMember()
+}
@@ -0,0 +1,118 @@
+package cmz
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+type testMember struct {
+	name    string
+	modTime time.Time
+	data    []byte
+}
+
+// writeArchive writes members to a new CMZ archive with the given settings.
+func writeArchive(t *testing.T, mode c.LiteralMode, dictSize int, members []testMember) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Mode, w.DictSize = mode, dictSize
+	for _, m := range members {
+		mw, err := w.CreateHeader(&c.Header{Filename: m.name, ModTime: m.modTime})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q): %v", m.name, err)
+		}
+		if _, err := mw.Write(m.data); err != nil {
+			t.Fatalf("writing %q: %v", m.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rng.Read(random)
+
+	// Text well beyond the largest dictionary, with repeats both within and
+	// beyond its reach.
+	var text bytes.Buffer
+	for i := 0; text.Len() < 100000; i++ {
+		fmt.Fprintf(&text, "Record %d: %x\r\n", i%251, random[i%len(random):][:8])
+	}
+
+	stamp := time.Date(1996, time.March, 14, 9, 26, 52, 0, time.Local)
+	members := []testMember{
+		{name: "EMPTY.TXT", modTime: stamp, data: nil},
+		{name: "BIG.TXT", modTime: stamp.Add(2 * time.Second), data: text.Bytes()},
+		{name: "RANDOM.BIN", modTime: time.Date(2107, time.December, 31, 23, 59, 58, 0, time.Local), data: random},
+		{name: "NOSTAMP.DAT", data: []byte("no modification time")},
+	}
+
+	for _, mode := range []c.LiteralMode{c.LiteralBinary, c.LiteralASCII} {
+		for _, dictSize := range []int{1024, 4096} {
+			t.Run(fmt.Sprintf("mode%d/dict%d", mode, dictSize), func(t *testing.T) {
+				archive := writeArchive(t, mode, dictSize, members)
+
+				headers, err := List(bytes.NewReader(archive))
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				files, err := Extract(bytes.NewReader(archive))
+				if err != nil {
+					t.Fatalf("Extract: %v", err)
+				}
+				if len(headers) != len(members) || len(files) != len(members) {
+					t.Fatalf("got %d headers and %d files, want %d", len(headers), len(files), len(members))
+				}
+
+				for i, m := range members {
+					h := headers[i]
+					if h.Filename != m.name {
+						t.Errorf("member %d: name %q, want %q", i, h.Filename, m.name)
+					}
+					if h.DecompressedSize != uint32(len(m.data)) {
+						t.Errorf("%s: decompressed size %d, want %d", m.name, h.DecompressedSize, len(m.data))
+					}
+					if !h.ModTime.Equal(m.modTime) {
+						t.Errorf("%s: modification time %v, want %v", m.name, h.ModTime, m.modTime)
+					}
+					if files[i].Filename != m.name {
+						t.Errorf("member %d: extracted name %q, want %q", i, files[i].Filename, m.name)
+					}
+					if !bytes.Equal(files[i].Data, m.data) {
+						t.Errorf("%s: extracted %d bytes that differ from the %d written", m.name, len(files[i].Data), len(m.data))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWriterEmptyArchive(t *testing.T) {
+	archive := writeArchive(t, DefaultMode, DefaultDictSize, nil)
+	if len(archive) != 0 {
+		t.Fatalf("archive without members is %d bytes, want 0", len(archive))
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	if _, err := w.Create(string(bytes.Repeat([]byte{'A'}, 256))); err == nil {
+		t.Error("Create with a 256 byte name succeeded")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := w.Create("LATE.TXT"); err == nil {
+		t.Error("Create after Close succeeded")
+	}
+}
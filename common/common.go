@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"io"
 	"time"
-
-	"github.com/JoshVarga/blast"
 )
 
 // FileType represents a type of compressed file
@@ -21,11 +19,13 @@ const (
 	TypeTSC
 	// TypeZAR represents a ZAR compressed file
 	TypeZAR
-	// TypeUnknown represents an unknown file type
+	// TypeUnknown represents an unknown file type. Formats registered from
+	// outside this module should use FileType values greater than TypeUnknown.
 	TypeUnknown
 )
 
-// Signatures holds the magic byte signatures for each file type
+// Signatures holds the magic byte signatures for each file type. It is read
+// by concurrent detections and must not be modified.
 var Signatures = map[FileType][]byte{
 	TypeCMZ: []byte{'C', 'l', 'a', 'y'},           // CMZ files start with "Clay".
 	TypeNSK: []byte{'N', 'S', 'K'},                // NSK files start with "NSK".
@@ -33,90 +33,67 @@ var Signatures = map[FileType][]byte{
 	TypeZAR: []byte{'P', 'T', '&'},                // ZAR files end with "PT&" in the footer.
 }
 
-// String returns the string representation of the FileType
-func (ft FileType) String() string {
-	switch ft {
-	case TypeCMZ:
-		return "CMZ"
-	case TypeNSK:
-		return "NSK"
-	case TypeTSC:
-		return "TSC"
-	case TypeZAR:
-		return "ZAR"
-	default:
-		return "Unknown"
-	}
-}
+// Attributes holds DOS file attribute bits, using the values of the DOS
+// directory entry attribute byte.
+type Attributes uint8
 
-// MaxSignatureLength is the length of the longest known file signature.
-var MaxSignatureLength int
+const (
+	AttrReadOnly Attributes = 0x01
+	AttrHidden   Attributes = 0x02
+	AttrSystem   Attributes = 0x04
+	AttrArchive  Attributes = 0x20
+)
 
-func init() {
-	for _, sig := range Signatures {
-		if len(sig) > MaxSignatureLength {
-			MaxSignatureLength = len(sig)
+// String returns the attributes in the style of the DOS ATTRIB command, e.g.
+// "R--A", with a dash for each attribute that is not set.
+func (a Attributes) String() string {
+	flags := []byte("RHSA")
+	for i, bit := range []Attributes{AttrReadOnly, AttrHidden, AttrSystem, AttrArchive} {
+		if a&bit == 0 {
+			flags[i] = '-'
 		}
 	}
+	return string(flags)
 }
 
-// ExtractedFileData holds the data and filename for a single extracted file.
-type ExtractedFileData struct {
+// Header describes a single archive member as stored in the archive.
+type Header struct {
 	Filename         string
-	Data             []byte
 	CompressedSize   uint32
-	DecompressedSize uint32
-	Version          string
+	DecompressedSize uint32     // Zero when the format does not store it.
+	Version          string     // Version of the program that created the archive, for formats that record it.
+	Speed            *int       // Compression speed setting the archive was created with; nil if the format does not store it.
+	ModTime          time.Time  // Zero when the format does not store it.
+	Attributes       Attributes // Zero when the format does not store them.
+	Offset           int64      // Offset of the compressed data in the archive.
 }
 
-// DetermineFileType checks the provided header and footer data against known signatures.
-func DetermineFileType(header, footer []byte) FileType {
-	// Check for header-based signatures first.
-	if bytes.HasPrefix(header, Signatures[TypeCMZ]) {
-		return TypeCMZ
-	}
-	if bytes.HasPrefix(header, Signatures[TypeNSK]) {
-		return TypeNSK
-	}
-	if bytes.HasPrefix(header, Signatures[TypeTSC]) {
-		return TypeTSC
+// Ratio returns the space saved by compression as a percentage. ok is false if
+// the decompressed size is not known.
+func (h *Header) Ratio() (ratio float64, ok bool) {
+	if h.DecompressedSize == 0 {
+		return 0, false
 	}
+	return 100 * (1 - float64(h.CompressedSize)/float64(h.DecompressedSize)), true
+}
 
-	// If no header signature matched, check for footer-based signatures.
-	if bytes.HasSuffix(footer, Signatures[TypeZAR]) {
-		return TypeZAR
-	}
-	return TypeUnknown
+// ExtractedFileData holds the data and filename for a single extracted file.
+type ExtractedFileData struct {
+	Header
+	Data []byte
 }
 
-// ReadAndDecompressBlastData reads compressed data from the provided io.Reader,
-// decompresses it using the blast package, and returns the decompressed data.
+// ReadAndDecompressBlastData reads compSize bytes of compressed data from the
+// provided io.Reader, decompresses it with the DCL explode decoder, and returns
+// the decompressed data. If decompSize is non-zero, the data must decompress
+// to exactly that many bytes.
+//
+// Deprecated: Use NewBlastReader or NewMemberReader, which decompress the data
+// as it is read instead of holding all of it in memory.
 func ReadAndDecompressBlastData(rs io.Reader, compSize, decompSize uint32) ([]byte, error) {
-	compressedData := make([]byte, compSize)
-	if _, err := io.ReadFull(rs, compressedData); err != nil {
-		return nil, fmt.Errorf("reading compressed data: %w", err)
-	}
-
-	blastReader, err := blast.NewReader(bytes.NewReader(compressedData))
-	if err != nil {
-		return nil, fmt.Errorf("creating blast reader: %w", err)
-	}
-	defer blastReader.Close() // Ensure reader is closed
-
-	// If decompressed size is not known, read everything until the stream ends.
-	if decompSize == 0 {
-		decompressedData, err := io.ReadAll(blastReader)
-		if err != nil {
-			return nil, fmt.Errorf("decompressing data with unknown size: %w", err)
-		}
-		return decompressedData, nil
-	}
-
-	decompressedData := make([]byte, decompSize)
-	if n, err := io.ReadFull(blastReader, decompressedData); err != nil {
-		return nil, fmt.Errorf("decompressing data (read %d of %d bytes): %w", n, decompSize, err)
-	}
-	return decompressedData, nil
+	r := NewBlastReader(rs, compSize, decompSize)
+	defer r.Close()
+	return io.ReadAll(r)
 }
 
 // ReadFilename reads a filename of a specified size from the provided io.Reader.
@@ -153,9 +130,8 @@ func ReadFileMagic(rs io.Reader, expectedMagic []byte) (bytesRead int, err error
 // and converts it to a time.Time object.
 func ReadDOSModifiedTimeStamp(rs io.Reader) (time.Time, error) {
 	var (
-		db                     [2]byte
-		tb                     [2]byte
-		yr, mo, da, hr, mi, se int
+		db [2]byte
+		tb [2]byte
 	)
 	// Read the date and time from the DOS timestamp.
 	if _, err := io.ReadFull(rs, db[:]); err != nil {
@@ -167,6 +143,15 @@ func ReadDOSModifiedTimeStamp(rs io.Reader) (time.Time, error) {
 
 	ddate := uint16(db[0]) | (uint16(db[1]) << 8)
 	dtime := uint16(tb[0]) | (uint16(tb[1]) << 8)
+	return DOSTime(ddate, dtime), nil
+}
+
+// DOSTime converts a DOS date and time to a time.Time. DOS records the local
+// wall-clock time without a zone, so the time is taken to be in the local
+// time zone of this machine. It returns the zero Time if the date is unset or
+// invalid, which is how archives that do not record a timestamp are reported.
+func DOSTime(ddate, dtime uint16) time.Time {
+	var yr, mo, da, hr, mi, se int
 
 	// Convert the DOS date and time to year, month, day, hour, minute, second.
 	yr = 1980 + int((ddate&0xfe00)>>9)
@@ -176,5 +161,51 @@ func ReadDOSModifiedTimeStamp(rs io.Reader) (time.Time, error) {
 	mi = int((dtime & 0x07e0) >> 5)
 	se = int(2 * (dtime & 0x001f))
 
-	return time.Date(yr, time.Month(mo), da, hr, mi, se, 0, time.UTC), nil
+	if mo < 1 || mo > 12 || da < 1 || hr > 23 || mi > 59 || se > 59 {
+		return time.Time{}
+	}
+	return time.Date(yr, time.Month(mo), da, hr, mi, se, 0, time.Local)
+}
+
+// DOSDateTime converts t to a DOS date and time in the local time zone,
+// matching DOSTime. Times that cannot be represented, including the zero Time,
+// are returned as zero.
+func DOSDateTime(t time.Time) (ddate, dtime uint16) {
+	t = t.Local()
+	if t.Year() < 1980 || t.Year() > 2107 {
+		return 0, 0
+	}
+	ddate = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	dtime = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return ddate, dtime
+}
+
+// SkipData seeks past size bytes of member data starting at offset, returning an
+// error if the data would extend beyond archiveSize.
+func SkipData(rs io.Seeker, offset int64, size uint32, archiveSize int64) error {
+	end := offset + int64(size)
+	if end > archiveSize {
+		return fmt.Errorf("member data ends at offset %d, beyond end of archive (%d bytes): %w", end, archiveSize, io.ErrUnexpectedEOF)
+	}
+	if _, err := rs.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking past member data: %w", err)
+	}
+	return nil
+}
+
+// ArchiveSize returns the total size of the archive, leaving the read position
+// unchanged.
+func ArchiveSize(rs io.Seeker) (int64, error) {
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
 }
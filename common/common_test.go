@@ -0,0 +1,27 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDOSTimeIsLocal(t *testing.T) {
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+
+	// 1996-03-14 09:26:52 as stored by DOS.
+	ddate, dtime := uint16(16<<9|3<<5|14), uint16(9<<11|26<<5|26)
+	want := time.Date(1996, time.March, 14, 9, 26, 52, 0, time.Local)
+	if got := DOSTime(ddate, dtime); !got.Equal(want) {
+		t.Errorf("DOSTime = %v, want %v", got, want)
+	}
+
+	// The same instant given in UTC is written as local wall-clock time.
+	if d, tm := DOSDateTime(want.UTC()); d != ddate || tm != dtime {
+		t.Errorf("DOSDateTime(%v) = %#04x %#04x, want %#04x %#04x", want.UTC(), d, tm, ddate, dtime)
+	}
+
+	if got := DOSTime(0, 0); !got.IsZero() {
+		t.Errorf("DOSTime(0, 0) = %v, want zero Time", got)
+	}
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of FormatError, for use with errors.Is.
+var (
+	ErrCorruptHeader = errors.New("corrupt header")
+	ErrTruncated     = errors.New("archive is truncated")
+	ErrBadMagic      = errors.New("bad magic")
+	ErrDecompress    = errors.New("decompression failed")
+)
+
+// FormatError describes a problem with the contents of an archive. It matches
+// its Kind and the underlying error with errors.Is.
+type FormatError struct {
+	Format string // Format name, e.g. "CMZ", if known.
+	Member int    // Index of the member being read, or -1 for the archive as a whole.
+	Offset int64  // Byte offset in the archive where the problem was found, or -1 if unknown.
+	Kind   error  // ErrCorruptHeader, ErrTruncated, ErrBadMagic or ErrDecompress.
+	Err    error  // Underlying error, may be nil.
+}
+
+// NewFormatError returns a FormatError of the given kind. If err is an
+// io.ErrUnexpectedEOF or io.EOF the kind is ErrTruncated regardless of kind,
+// since a short read always means the archive ended early.
+func NewFormatError(format string, member int, offset int64, kind, err error) *FormatError {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		kind = ErrTruncated
+	}
+	return &FormatError{Format: format, Member: member, Offset: offset, Kind: kind, Err: err}
+}
+
+func (e *FormatError) Error() string {
+	var b strings.Builder
+	if e.Format != "" {
+		b.WriteString(e.Format + ": ")
+	}
+	if e.Member >= 0 {
+		fmt.Fprintf(&b, "member %d: ", e.Member+1)
+	}
+	if e.Offset >= 0 {
+		fmt.Fprintf(&b, "offset %d: ", e.Offset)
+	}
+	if e.Kind != nil {
+		b.WriteString(e.Kind.Error())
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *FormatError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
@@ -0,0 +1,313 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// This file implements a decoder for the PKWARE Data Compression Library
+// "implode" format, following the description in Mark Adler's blast.c.
+//
+// A compressed stream starts with two header bytes: the literal mode (0 for
+// uncoded binary literals, 1 for Huffman coded ASCII literals) and the log2 of
+// the dictionary size minus 6 (4, 5 or 6 for 1024, 2048 or 4096 bytes). The
+// rest is a little-endian bit stream of literals and length/distance pairs,
+// terminated by the length code for 519.
+
+const (
+	maxBits     = 13   // Longest Huffman code in any of the tables.
+	maxWindow   = 4096 // Largest dictionary size.
+	endOfStream = 519  // Length value that marks the end of the stream.
+)
+
+// LiteralMode selects how literal bytes are stored in a DCL stream.
+type LiteralMode int
+
+const (
+	// LiteralBinary stores literals as plain 8-bit values.
+	LiteralBinary LiteralMode = 0
+	// LiteralASCII stores literals with a fixed Huffman code suited to text.
+	LiteralASCII LiteralMode = 1
+)
+
+// Errors reported by the DCL decoder, wrapped in an *ExplodeError.
+var (
+	ErrLiteralMode    = errors.New("invalid literal mode")
+	ErrDictionarySize = errors.New("invalid dictionary size")
+	ErrInvalidCode    = errors.New("invalid Huffman code")
+	ErrDistance       = errors.New("distance is too far back")
+)
+
+// ExplodeError describes where decoding DCL compressed data failed.
+type ExplodeError struct {
+	BitOffset int64  // Position in the compressed stream, in bits.
+	Table     string // Huffman table being decoded ("literal", "length" or "distance"), if any.
+	Err       error
+}
+
+func (e *ExplodeError) Error() string {
+	if e.Table != "" {
+		return fmt.Sprintf("explode: bit offset %d: %s table: %v", e.BitOffset, e.Table, e.Err)
+	}
+	return fmt.Sprintf("explode: bit offset %d: %v", e.BitOffset, e.Err)
+}
+
+func (e *ExplodeError) Unwrap() error { return e.Err }
+
+// huffman is a canonical Huffman decoding table: the number of codes of each
+// length and the symbols ordered by code.
+type huffman struct {
+	count  [maxBits + 1]int
+	symbol []int
+}
+
+// newHuffman builds a decoding table from the compact code length description
+// used by the DCL format. Each byte gives a code length in its low nibble and
+// a repeat count minus one in its high nibble.
+func newHuffman(rep []byte) *huffman {
+	var lengths []int
+	for _, b := range rep {
+		for n := int(b>>4) + 1; n > 0; n-- {
+			lengths = append(lengths, int(b&15))
+		}
+	}
+
+	h := &huffman{symbol: make([]int, len(lengths))}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	var offs [maxBits + 1]int
+	for l := 1; l < maxBits; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = sym
+			offs[l]++
+		}
+	}
+	return h
+}
+
+var (
+	// Code lengths of the literal, length and distance codes.
+	litCode = newHuffman([]byte{
+		11, 124, 8, 7, 28, 7, 188, 13, 76, 4, 10, 8, 12, 10, 12, 10, 8, 23, 8,
+		9, 7, 6, 7, 8, 7, 6, 55, 8, 23, 24, 12, 11, 7, 9, 11, 12, 6, 7, 22, 5,
+		7, 24, 6, 11, 9, 6, 7, 22, 7, 11, 38, 7, 9, 8, 25, 11, 8, 11, 9, 12,
+		8, 12, 5, 38, 5, 38, 5, 11, 7, 5, 6, 21, 6, 10, 53, 8, 7, 24, 10, 27,
+		44, 253, 253, 253, 252, 252, 252, 13, 12, 45, 12, 45, 12, 61, 12, 45,
+		44, 173,
+	})
+	lenCode  = newHuffman([]byte{2, 35, 36, 53, 38, 23})
+	distCode = newHuffman([]byte{2, 20, 53, 230, 247, 151, 248})
+
+	// Base values and extra bits for the 16 length codes.
+	lenBase  = [16]int{3, 2, 4, 5, 6, 7, 8, 9, 10, 12, 16, 24, 40, 72, 136, 264}
+	lenExtra = [16]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+)
+
+// explodeReader decompresses a DCL stream incrementally through a sliding
+// window, so memory use does not depend on the size of the data.
+type explodeReader struct {
+	r      io.Reader
+	in     [512]byte
+	inPos  int
+	inLen  int
+	bitBuf uint32
+	bitCnt uint
+	bitOff int64 // Bits consumed from the stream so far.
+
+	started  bool
+	coded    bool // Literals are Huffman coded.
+	dictBits uint
+
+	window [maxWindow]byte
+	total  int64 // Bytes written to the window so far.
+	copyN  int   // Bytes left to copy for the current length/distance pair.
+	dist   int   // Distance of the current pair.
+
+	err error // Sticky error, including io.EOF after the end code.
+}
+
+// NewExplodeReader returns a reader that decompresses the PKWARE DCL imploded
+// data read from r. Both binary and ASCII literal modes and all dictionary
+// sizes are supported. Decoding errors are returned as *ExplodeError.
+func NewExplodeReader(r io.Reader) io.Reader {
+	return &explodeReader{r: r}
+}
+
+func (d *explodeReader) fail(table string, err error) error {
+	d.err = &ExplodeError{BitOffset: d.bitOff, Table: table, Err: err}
+	return d.err
+}
+
+// needBits ensures at least n bits are buffered.
+func (d *explodeReader) needBits(n uint) error {
+	for d.bitCnt < n {
+		if d.inPos == d.inLen {
+			m, err := d.r.Read(d.in[:])
+			if m == 0 {
+				if err == nil {
+					continue
+				}
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			d.inPos, d.inLen = 0, m
+		}
+		d.bitBuf |= uint32(d.in[d.inPos]) << d.bitCnt
+		d.inPos++
+		d.bitCnt += 8
+	}
+	return nil
+}
+
+// bits reads n bits, least significant first.
+func (d *explodeReader) bits(n uint) (int, error) {
+	if err := d.needBits(n); err != nil {
+		return 0, err
+	}
+	v := int(d.bitBuf & (1<<n - 1))
+	d.bitBuf >>= n
+	d.bitCnt -= n
+	d.bitOff += int64(n)
+	return v, nil
+}
+
+// decode reads one symbol using table h. DCL codes are stored inverted, so
+// each bit is complemented as it is read.
+func (d *explodeReader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxBits; l++ {
+		b, err := d.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= b ^ 1
+		count := h.count[l]
+		if code < first+count {
+			return h.symbol[index+code-first], nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, ErrInvalidCode
+}
+
+// readHeader reads the literal mode and dictionary size.
+func (d *explodeReader) readHeader() error {
+	lit, err := d.bits(8)
+	if err != nil {
+		return d.fail("", err)
+	}
+	if lit != int(LiteralBinary) && lit != int(LiteralASCII) {
+		return d.fail("", fmt.Errorf("%w %d", ErrLiteralMode, lit))
+	}
+	dict, err := d.bits(8)
+	if err != nil {
+		return d.fail("", err)
+	}
+	if dict < 4 || dict > 6 {
+		return d.fail("", fmt.Errorf("%w %d", ErrDictionarySize, dict))
+	}
+	d.coded = lit == int(LiteralASCII)
+	d.dictBits = uint(dict)
+	d.started = true
+	return nil
+}
+
+// next decodes the next literal or length/distance pair. For a literal it
+// returns the byte with ok set; for a pair it sets copyN and dist.
+func (d *explodeReader) next() (lit byte, ok bool, err error) {
+	flag, err := d.bits(1)
+	if err != nil {
+		return 0, false, d.fail("", err)
+	}
+
+	if flag == 0 {
+		var sym int
+		if d.coded {
+			sym, err = d.decode(litCode)
+			if err != nil {
+				return 0, false, d.fail("literal", err)
+			}
+		} else if sym, err = d.bits(8); err != nil {
+			return 0, false, d.fail("", err)
+		}
+		return byte(sym), true, nil
+	}
+
+	sym, err := d.decode(lenCode)
+	if err != nil {
+		return 0, false, d.fail("length", err)
+	}
+	extra, err := d.bits(lenExtra[sym])
+	if err != nil {
+		return 0, false, d.fail("length", err)
+	}
+	length := lenBase[sym] + extra
+	if length == endOfStream {
+		d.err = io.EOF
+		return 0, false, io.EOF
+	}
+
+	lowBits := d.dictBits
+	if length == 2 {
+		lowBits = 2
+	}
+	sym, err = d.decode(distCode)
+	if err != nil {
+		return 0, false, d.fail("distance", err)
+	}
+	low, err := d.bits(lowBits)
+	if err != nil {
+		return 0, false, d.fail("distance", err)
+	}
+	dist := sym<<lowBits + low + 1
+	if int64(dist) > d.total {
+		return 0, false, d.fail("distance", fmt.Errorf("%w (%d bytes back, %d available)", ErrDistance, dist, d.total))
+	}
+	d.copyN, d.dist = length, dist
+	return 0, false, nil
+}
+
+func (d *explodeReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if !d.started {
+		if err := d.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for n < len(p) {
+		if d.copyN > 0 {
+			b := d.window[(d.total-int64(d.dist))%maxWindow]
+			d.window[d.total%maxWindow] = b
+			d.total++
+			d.copyN--
+			p[n] = b
+			n++
+			continue
+		}
+
+		lit, ok, err := d.next()
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			d.window[d.total%maxWindow] = lit
+			d.total++
+			p[n] = lit
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// The example from Mark Adler's blast.c.
+var (
+	blastExample     = []byte{0x00, 0x04, 0x82, 0x24, 0x25, 0x8f, 0x80, 0x7f}
+	blastExampleText = "AIAIAIAIAIAIA"
+)
+
+func TestExplodeReference(t *testing.T) {
+	got, err := io.ReadAll(NewExplodeReader(bytes.NewReader(blastExample)))
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != blastExampleText {
+		t.Errorf("got %q, want %q", got, blastExampleText)
+	}
+
+	// The bit stream must decode the same however the input is split.
+	got, err = io.ReadAll(NewExplodeReader(iotest.OneByteReader(bytes.NewReader(blastExample))))
+	if err != nil {
+		t.Fatalf("ReadAll one byte at a time: %v", err)
+	}
+	if string(got) != blastExampleText {
+		t.Errorf("one byte at a time: got %q, want %q", got, blastExampleText)
+	}
+}
+
+func TestExplodeErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        []byte
+		want      error
+		bitOffset int64
+		table     string
+	}{
+		{"empty", nil, io.ErrUnexpectedEOF, 0, ""},
+		{"literal mode", []byte{0x07, 0x04}, ErrLiteralMode, 8, ""},
+		{"dictionary size", []byte{0x00, 0x07}, ErrDictionarySize, 16, ""},
+		{"truncated header", []byte{0x00}, io.ErrUnexpectedEOF, 8, ""},
+		{"truncated literal", []byte{0x00, 0x04, 0x00, 0x00}, io.ErrUnexpectedEOF, 26, ""},
+		{"truncated length", []byte{0x00, 0x04, 0x00, 0x02}, io.ErrUnexpectedEOF, 32, "length"},
+		{"truncated distance", []byte{0x00, 0x04, 0x00, 0x06}, io.ErrUnexpectedEOF, 32, "distance"},
+		{"distance too far", []byte{0x00, 0x04, 0x03, 0x00}, ErrDistance, 32, "distance"},
+		{"no end of stream", blastExample[:6], io.ErrUnexpectedEOF, 48, "length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(NewExplodeReader(bytes.NewReader(tt.in)))
+			var e *ExplodeError
+			if !errors.As(err, &e) {
+				t.Fatalf("got error %v, want *ExplodeError", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+			if e.BitOffset != tt.bitOffset || e.Table != tt.table {
+				t.Errorf("got bit offset %d, table %q; want %d, %q", e.BitOffset, e.Table, tt.bitOffset, tt.table)
+			}
+		})
+	}
+}
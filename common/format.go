@@ -0,0 +1,124 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Format is implemented by each supported archive format. Format packages
+// register an implementation with Register from their init function.
+type Format interface {
+	// Name returns the short display name of the format, e.g. "CMZ".
+	Name() string
+	// Signature returns the magic bytes used to identify the format.
+	Signature() []byte
+	// Match reports whether the given header and footer bytes of a file
+	// belong to this format. Both slices hold at most MaxSignatureLength bytes.
+	Match(header, footer []byte) bool
+	// List reads the member headers of the archive without decompressing.
+	List(rs io.ReadSeeker) ([]Header, error)
+	// NewReader returns a MemberReader that streams the members of the archive.
+	NewReader(rs io.ReadSeeker) MemberReader
+	// Extract reads and extracts all members of the archive.
+	Extract(rs io.ReadSeeker) ([]ExtractedFileData, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[FileType]Format{}
+
+	// MaxSignatureLength is the length of the longest registered file signature.
+	MaxSignatureLength int
+)
+
+// Register makes a format available for detection and extraction under the
+// given FileType. It panics if f is nil or the FileType is already registered.
+func Register(ft FileType, f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	if f == nil {
+		panic("common: Register format is nil")
+	}
+	if _, dup := formats[ft]; dup {
+		panic(fmt.Sprintf("common: Register called twice for file type %d", int(ft)))
+	}
+	formats[ft] = f
+	if n := len(f.Signature()); n > MaxSignatureLength {
+		MaxSignatureLength = n
+	}
+}
+
+// Lookup returns the format registered for the given FileType.
+func Lookup(ft FileType) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[ft]
+	return f, ok
+}
+
+// FileTypes returns the registered FileTypes in detection order.
+func FileTypes() []FileType {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	types := make([]FileType, 0, len(formats))
+	for ft := range formats {
+		types = append(types, ft)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// String returns the registered name of the FileType.
+func (ft FileType) String() string {
+	if f, ok := Lookup(ft); ok {
+		return f.Name()
+	}
+	return "Unknown"
+}
+
+// DetermineFileType checks the provided header and footer data against the
+// registered formats, in ascending FileType order.
+//
+// Deprecated: Use Detect, which also checks the structure of the file and
+// ranks the formats it may be in.
+func DetermineFileType(header, footer []byte) FileType {
+	for _, ft := range FileTypes() {
+		if f, ok := Lookup(ft); ok && f.Match(header, footer) {
+			return ft
+		}
+	}
+	return TypeUnknown
+}
+
+// ArchiveWriter writes members to a new archive.
+type ArchiveWriter interface {
+	// CreateHeader adds a member described by h and returns a writer for its
+	// uncompressed data. The data must be written before the next call to
+	// CreateHeader or Close.
+	CreateHeader(h *Header) (io.Writer, error)
+	// Close finishes the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// Creator is implemented by formats that can create archives as well as read
+// them.
+type Creator interface {
+	// NewWriter returns an ArchiveWriter that compresses members with the
+	// given DCL literal mode and dictionary size.
+	NewWriter(w io.Writer, mode LiteralMode, dictSize int) ArchiveWriter
+}
+
+// LookupName returns the registered FileType whose format name matches name,
+// ignoring case.
+func LookupName(name string) (FileType, bool) {
+	for _, ft := range FileTypes() {
+		if f, ok := Lookup(ft); ok && strings.EqualFold(f.Name(), name) {
+			return ft, true
+		}
+	}
+	return TypeUnknown, false
+}
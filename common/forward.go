@@ -0,0 +1,58 @@
+package common
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotSeekable is returned by a ForwardReader asked to seek backwards or
+// relative to the end of its input.
+var ErrNotSeekable = errors.New("input can only be read forwards")
+
+// Streamer is implemented by formats whose archives can be read front to back,
+// from an io.Reader that cannot seek, such as a pipe.
+type Streamer interface {
+	// NewStreamReader returns a MemberReader that streams the members of the
+	// archive read from r.
+	NewStreamReader(r io.Reader) MemberReader
+}
+
+// ForwardReader adapts an io.Reader to io.ReadSeeker for the formats that read
+// archives front to back. Seeking forwards discards the data skipped over;
+// seeking backwards or relative to the end fails with ErrNotSeekable.
+type ForwardReader struct {
+	r   io.Reader
+	pos int64
+}
+
+// NewForwardReader returns a ForwardReader reading from r, which is taken to
+// be positioned at offset zero.
+func NewForwardReader(r io.Reader) *ForwardReader {
+	return &ForwardReader{r: r}
+}
+
+func (f *ForwardReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker for positions at or after the current one.
+func (f *ForwardReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	default:
+		return f.pos, ErrNotSeekable
+	}
+	if offset < f.pos {
+		return f.pos, ErrNotSeekable
+	}
+	n, err := io.CopyN(io.Discard, f.r, offset-f.pos)
+	f.pos += n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return f.pos, err
+}
@@ -0,0 +1,295 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS is a read-only file system view of an archive. It implements
+// fs.ReadDirFS and fs.StatFS, so archives can be used with fs.WalkDir,
+// http.FS, template.ParseFS and the like. Members are found at the path they
+// would be extracted to, as returned by SanitizePath with slash separators,
+// and are decompressed when they are opened.
+type FS struct {
+	ra      io.ReaderAt
+	format  string
+	headers []Header
+	root    *fsNode
+
+	mu    sync.Mutex
+	sizes map[int]memberSize // Decompressed sizes of members that do not store them.
+}
+
+// memberSize is the outcome of decompressing a member to find its size.
+type memberSize struct {
+	size int64
+	err  error
+}
+
+// fsNode is a file or directory in an FS.
+type fsNode struct {
+	name     string
+	member   int                // Index of the member in FS.headers, or -1 for a directory.
+	children map[string]*fsNode // Entries of a directory.
+}
+
+// NewFS returns a file system view of the archive in the given format that is
+// read from r, which holds size bytes. Nameless members are named by calling
+// name with their index, in archive order, so that they can be given the names
+// they are extracted under; if name is nil they are named extracted_file_
+// followed by their index. If several members have the same path, the last
+// one is used, as when extracting.
+func NewFS(r io.ReaderAt, size int64, format Format, name func(i int) string) (*FS, error) {
+	headers, err := format.List(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := &FS{ra: r, format: format.Name(), headers: headers, root: newDirNode("."), sizes: map[int]memberSize{}}
+	for i, h := range headers {
+		path := filepath.ToSlash(SanitizePath(h.Filename))
+		if path == "" && name != nil {
+			path = filepath.ToSlash(name(i))
+		} else if path == "" {
+			path = fmt.Sprintf("extracted_file_%d", i)
+		}
+		dir := fsys.root
+		elems := strings.Split(path, "/")
+		for _, elem := range elems[:len(elems)-1] {
+			child, ok := dir.children[elem]
+			if !ok || child.member >= 0 {
+				child = newDirNode(elem)
+				dir.children[elem] = child
+			}
+			dir = child
+		}
+		if child, ok := dir.children[elems[len(elems)-1]]; ok && child.member < 0 {
+			continue // A directory of the same name takes precedence.
+		}
+		dir.children[elems[len(elems)-1]] = &fsNode{name: elems[len(elems)-1], member: i}
+	}
+	return fsys, nil
+}
+
+func newDirNode(name string) *fsNode {
+	return &fsNode{name: name, member: -1, children: map[string]*fsNode{}}
+}
+
+// lookup returns the node at name, which must be a valid fs path.
+func (fsys *FS) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n := fsys.root
+	if name == "." {
+		return n, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		child, ok := n.children[elem]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// Open opens the named file or directory. A member is decompressed in full
+// when it is opened, so the returned file also implements io.Seeker and
+// io.ReaderAt.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.member < 0 {
+		return &fsDir{info: fileInfo{fsys, n}, entries: fsys.entries(n)}, nil
+	}
+
+	data, err := io.ReadAll(fsys.member(n.member))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	fsys.mu.Lock()
+	fsys.sizes[n.member] = memberSize{size: int64(len(data))}
+	fsys.mu.Unlock()
+	return &fsFile{info: fileInfo{fsys, n}, Reader: bytes.NewReader(data)}, nil
+}
+
+// Stat returns information about the named file or directory. The size of a
+// member is found by decompressing it if the format does not store it, and
+// an error is returned if that fails.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi := fileInfo{fsys, n}
+	if err := fi.checkSize(); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.member >= 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return fsys.entries(n), nil
+}
+
+// entries returns the entries of the directory n, sorted by name.
+func (fsys *FS) entries(n *fsNode) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, dirEntry{fileInfo{fsys, child}})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// member returns a reader for the decompressed data of member i.
+func (fsys *FS) member(i int) io.ReadCloser {
+	h := &fsys.headers[i]
+	return NewMemberReader(io.NewSectionReader(fsys.ra, h.Offset, int64(h.CompressedSize)), fsys.format, i, h)
+}
+
+// size returns the decompressed size of member i. Members whose format does
+// not store the size are decompressed to find it, once, and the error is
+// returned if that fails.
+func (fsys *FS) size(i int) (int64, error) {
+	if s := fsys.headers[i].DecompressedSize; s != 0 {
+		return int64(s), nil
+	}
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if s, ok := fsys.sizes[i]; ok {
+		return s.size, s.err
+	}
+	r := fsys.member(i)
+	defer r.Close()
+	s, err := io.Copy(io.Discard, r)
+	fsys.sizes[i] = memberSize{size: s, err: err}
+	return s, err
+}
+
+// fileInfo describes a file or directory of an FS. Sys returns the member's
+// *Header for files.
+type fileInfo struct {
+	fsys *FS
+	n    *fsNode
+}
+
+func (fi fileInfo) Name() string { return fi.n.name }
+func (fi fileInfo) IsDir() bool  { return fi.n.member < 0 }
+
+// checkSize finds the size of a member, returning an error if it does not
+// decompress. A fileInfo is only handed out once this has succeeded, so Size
+// never reports a partial length.
+func (fi fileInfo) checkSize() error {
+	if fi.IsDir() {
+		return nil
+	}
+	_, err := fi.fsys.size(fi.n.member)
+	return err
+}
+
+func (fi fileInfo) Size() int64 {
+	if fi.IsDir() {
+		return 0
+	}
+	s, _ := fi.fsys.size(fi.n.member)
+	return s
+}
+
+// Mode returns read-only permissions for members stored as read-only.
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	if fi.fsys.headers[fi.n.member].Attributes&AttrReadOnly != 0 {
+		return 0444
+	}
+	return 0644
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	if fi.IsDir() {
+		return time.Time{}
+	}
+	return fi.fsys.headers[fi.n.member].ModTime
+}
+
+func (fi fileInfo) Sys() any {
+	if fi.IsDir() {
+		return nil
+	}
+	return &fi.fsys.headers[fi.n.member]
+}
+
+// dirEntry is an entry of a directory of an FS.
+type dirEntry struct {
+	fileInfo
+}
+
+func (d dirEntry) Type() fs.FileMode { return d.Mode().Type() }
+
+// Info returns the entry's FileInfo, decompressing the member to find its size
+// if the format does not store it. It returns an error if that fails.
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	if err := d.checkSize(); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: d.Name(), Err: err}
+	}
+	return d.fileInfo, nil
+}
+
+// fsFile is an open member of an FS.
+type fsFile struct {
+	info fileInfo
+	*bytes.Reader
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDir is an open directory of an FS.
+type fsDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int // Number of entries returned by ReadDir so far.
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(count, len(rest))]
+	d.offset += len(rest)
+	return rest, nil
+}
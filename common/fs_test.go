@@ -0,0 +1,112 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// testFormat reads archives built from testArchive: the signature followed by
+// members in the layout that readTestHeader reads.
+type testFormat struct{}
+
+func (testFormat) Name() string                                       { return "TST" }
+func (testFormat) Signature() []byte                                  { return testSig }
+func (testFormat) Match(header, footer []byte) bool                   { return bytes.HasPrefix(header, testSig) }
+func (testFormat) NewReader(rs io.ReadSeeker) MemberReader            { return nil }
+func (testFormat) Extract(io.ReadSeeker) ([]ExtractedFileData, error) { return nil, nil }
+
+func (testFormat) List(rs io.ReadSeeker) ([]Header, error) {
+	size, err := ArchiveSize(rs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ReadFileMagic(rs, testSig); err != nil {
+		return nil, err
+	}
+	var headers []Header
+	for {
+		h, err := readTestHeader(rs)
+		if err == io.EOF {
+			return headers, nil
+		}
+		if err != nil {
+			return headers, err
+		}
+		if err := SkipData(rs, h.Offset, h.CompressedSize, size); err != nil {
+			return headers, err
+		}
+		headers = append(headers, *h)
+	}
+}
+
+// testFS returns an FS over an archive in testFormat holding a member for each
+// name, with its name as contents.
+func testFS(t *testing.T, name func(int) string, names ...string) *FS {
+	t.Helper()
+	b := append([]byte{}, testSig...)
+	for _, n := range names {
+		b = append(b, testArchive(nil, n, imploded(t, []byte("contents of "+n)))...)
+	}
+	fsys, err := NewFS(bytes.NewReader(b), int64(len(b)), testFormat{}, name)
+	if err != nil {
+		t.Fatalf("NewFS: %v", err)
+	}
+	return fsys
+}
+
+func TestFS(t *testing.T) {
+	fsys := testFS(t, nil, "README.TXT", `DOCS\MANUAL.TXT`, `C:\DOCS\INDEX.TXT`, "", "")
+	if err := fstest.TestFS(fsys, "README.TXT", "DOCS/MANUAL.TXT", "DOCS/INDEX.TXT", "extracted_file_3", "extracted_file_4"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "DOCS/MANUAL.TXT")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if want := `contents of DOCS\MANUAL.TXT`; string(data) != want {
+		t.Errorf("ReadFile = %q, want %q", data, want)
+	}
+}
+
+func TestFSNamelessMembers(t *testing.T) {
+	var indexes []int
+	name := func(i int) string {
+		indexes = append(indexes, i)
+		return fmt.Sprintf("DISK1_%d", len(indexes)-1)
+	}
+	fsys := testFS(t, name, "", "README.TXT", "")
+	if err := fstest.TestFS(fsys, "DISK1_0", "README.TXT", "DISK1_1"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 2}; fmt.Sprint(indexes) != fmt.Sprint(want) {
+		t.Errorf("name called with %v, want %v", indexes, want)
+	}
+}
+
+func TestFSCorruptMember(t *testing.T) {
+	b := testArchive(testSig, "BAD.TXT", []byte{7, 4, 0x12, 0x34}) // Literal mode 7 is invalid.
+	fsys, err := NewFS(bytes.NewReader(b), int64(len(b)), testFormat{}, nil)
+	if err != nil {
+		t.Fatalf("NewFS: %v", err)
+	}
+
+	if _, err := fsys.Stat("BAD.TXT"); !errors.Is(err, ErrDecompress) {
+		t.Errorf("Stat error = %v, want %v", err, ErrDecompress)
+	}
+	if _, err := fsys.Open("BAD.TXT"); !errors.Is(err, ErrDecompress) {
+		t.Errorf("Open error = %v, want %v", err, ErrDecompress)
+	}
+	entries, err := fsys.ReadDir(".")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir = %v, %v; want one entry", entries, err)
+	}
+	if _, err := entries[0].Info(); !errors.Is(err, ErrDecompress) {
+		t.Errorf("Info error = %v, want %v", err, ErrDecompress)
+	}
+}
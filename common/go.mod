@@ -1,5 +0,0 @@
-module github.com/sourcekris/dclextract/common
-
-go 1.21.1
-
-require github.com/JoshVarga/blast v0.0.0-20210808061142-eadad17358e8
@@ -0,0 +1,220 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// MinConfidence is the confidence a Candidate needs for a file to be treated
+// as an archive in its format.
+const MinConfidence = 50
+
+// Candidate is a possible format for a file, as returned by Identify.
+type Candidate struct {
+	Type       FileType
+	Confidence int      // From 0 to 100.
+	Evidence   []string // What was found for and against the format, in the order checked.
+}
+
+// Add adjusts the confidence by points, which may be negative, and records why.
+func (cd *Candidate) Add(points int, format string, args ...any) {
+	cd.Confidence += points
+	cd.Evidence = append(cd.Evidence, fmt.Sprintf("%+d %s", points, fmt.Sprintf(format, args...)))
+}
+
+// Prober is implemented by formats that check the structure of a file, and
+// not just its signature, when identifying it.
+type Prober interface {
+	// Probe examines rs and returns how likely it is to hold an archive in
+	// this format. The position of rs is left undefined.
+	Probe(rs io.ReadSeeker) Candidate
+}
+
+// Identify examines rs with every registered format and returns the formats
+// it may be in, most likely first. Formats that do not implement Prober are
+// judged by their signature alone. Candidates with no confidence at all are
+// left out unless their signature matches. rs is left positioned at the start.
+func Identify(rs io.ReadSeeker) ([]Candidate, error) {
+	header, footer, err := readSignatureBytes(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	for _, ft := range FileTypes() {
+		f, ok := Lookup(ft)
+		if !ok {
+			continue
+		}
+		var cd Candidate
+		match := f.Match(header, footer)
+		if p, ok := f.(Prober); ok {
+			cd = p.Probe(rs)
+		} else if match {
+			cd.Add(MinConfidence, "signature matches")
+		}
+		cd.Type = ft
+		cd.Confidence = min(max(cd.Confidence, 0), 100)
+		if cd.Confidence > 0 || match {
+			candidates = append(candidates, cd)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Confidence > candidates[j].Confidence })
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// Detect returns the most likely format of rs, or TypeUnknown if no format
+// reaches MinConfidence. rs is left positioned at the start.
+func Detect(rs io.ReadSeeker) (FileType, error) {
+	candidates, err := Identify(rs)
+	if err != nil {
+		return TypeUnknown, err
+	}
+	if len(candidates) == 0 || candidates[0].Confidence < MinConfidence {
+		return TypeUnknown, nil
+	}
+	return candidates[0].Type, nil
+}
+
+// readSignatureBytes returns up to MaxSignatureLength bytes from the start
+// and the end of rs, for Format.Match.
+func readSignatureBytes(rs io.ReadSeeker) (header, footer []byte, err error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not determine file size: %w", err)
+	}
+	n := min(size, int64(MaxSignatureLength))
+	header, footer = make([]byte, n), make([]byte, n)
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(rs, header); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rs.Seek(size-n, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(rs, footer); err != nil {
+		return nil, nil, err
+	}
+	return header, footer, nil
+}
+
+// ProbeArchive returns the Candidate for an archive that starts with the
+// signature sig and has its first member header at headerLen. readHeader reads
+// that header from rs, leaving rs positioned at the start of the member's data,
+// and returns an error matching io.EOF if no members follow. A matching
+// signature reaches MinConfidence on its own, so that archives whose first
+// member cannot be checked, such as truncated ones, are still recognized.
+// Evidence against the format, such as a name with control characters or data
+// that does not decompress, brings it below. Without the signature, the first
+// member must decompress.
+func ProbeArchive(rs io.ReadSeeker, sig []byte, headerLen int64, readHeader func(io.ReadSeeker) (*Header, error)) Candidate {
+	var cd Candidate
+	size, err := ArchiveSize(rs)
+	if err != nil {
+		return cd
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return cd
+	}
+	sigText := fmt.Sprintf("%x", sig)
+	if PlausibleName(string(sig)) {
+		sigText = fmt.Sprintf("%q", sig)
+	}
+	_, err = ReadFileMagic(rs, sig)
+	matched := err == nil
+	if matched {
+		cd.Add(MinConfidence, "signature %s at start", sigText)
+	} else {
+		cd.Add(0, "no signature %s at start", sigText)
+	}
+
+	cd.addFirstMember(rs, headerLen, size, readHeader)
+	return cd
+}
+
+// addFirstMember adds the evidence from the first member of an archive of the
+// given size, read as for ProbeArchive.
+func (cd *Candidate) addFirstMember(rs io.ReadSeeker, headerLen, size int64, readHeader func(io.ReadSeeker) (*Header, error)) {
+	if _, err := rs.Seek(headerLen, io.SeekStart); err != nil {
+		return
+	}
+	h, err := readHeader(rs)
+	if errors.Is(err, io.EOF) && size == headerLen {
+		cd.Add(0, "no members follow the archive header")
+		return
+	}
+	if err != nil {
+		cd.Add(0, "first member header is incomplete")
+		return
+	}
+	cd.AddMember(rs, h, size)
+}
+
+// AddMember adds the evidence from the first member of an archive of the
+// given size: whether its name is plausible, whether its data fits in the file
+// and whether it starts with valid DCL compressed data. An empty name, a
+// member that stores no data and data that decompresses to nothing are no
+// evidence either way, so a file of zeros does not look like an archive.
+func (cd *Candidate) AddMember(rs io.ReadSeeker, h *Header, size int64) {
+	switch {
+	case h.Filename == "":
+		cd.Add(0, "first member has no name")
+	case PlausibleName(h.Filename):
+		cd.Add(20, "first member name %q is plausible", h.Filename)
+	default:
+		cd.Add(-20, "first member name %q contains control characters", h.Filename)
+	}
+	if h.CompressedSize == 0 {
+		cd.Add(0, "first member stores no data")
+		return
+	}
+	if end := h.Offset + int64(h.CompressedSize); end <= size {
+		cd.Add(20, "first member data ends within the file")
+	} else {
+		cd.Add(0, "first member data ends at offset %d, past the end of the file (%d bytes)", end, size)
+	}
+	n, err := TrialDecode(rs, h)
+	switch {
+	case err != nil:
+		cd.Add(-30, "first member does not decompress: %v", err)
+	case n == 0:
+		cd.Add(0, "first member decompresses to nothing")
+	default:
+		cd.Add(30, "first member starts with valid DCL compressed data")
+	}
+}
+
+// TrialDecode decompresses the start of the member described by h to check
+// that it holds DCL compressed data, and returns the number of bytes it
+// decompressed, up to 512. Running out of data is not an error, so members of
+// truncated archives still pass.
+func TrialDecode(rs io.ReadSeeker, h *Header) (int, error) {
+	if _, err := rs.Seek(h.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	d := NewExplodeReader(io.LimitReader(rs, int64(h.CompressedSize)))
+	n, err := io.ReadFull(d, make([]byte, 512))
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	return n, err
+}
+
+// PlausibleName reports whether name could be a DOS filename stored in an
+// archive: it may be empty, but must not contain control characters.
+func PlausibleName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
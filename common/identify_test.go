@@ -0,0 +1,91 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testSig is the signature of the archives built by testArchive.
+var testSig = []byte("TST")
+
+// testArchive returns an archive with the signature sig and a single member:
+// the length of its name, the name, the compressed size and the data.
+func testArchive(sig []byte, name string, data []byte) []byte {
+	b := append([]byte{}, sig...)
+	b = append(b, byte(len(name)))
+	b = append(b, name...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// readTestHeader reads a member header of an archive built by testArchive.
+func readTestHeader(rs io.ReadSeeker) (*Header, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(rs, n[:]); err != nil {
+		return nil, err
+	}
+	name, err := ReadFilename(rs, int(n[0]))
+	if err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(rs, size[:]); err != nil {
+		return nil, err
+	}
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Filename: name, CompressedSize: binary.LittleEndian.Uint32(size[:]), Offset: offset}, nil
+}
+
+// imploded returns data compressed with the DCL implode compressor.
+func imploded(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewImplodeWriter(&buf, LiteralBinary, 1024)
+	if err != nil {
+		t.Fatalf("NewImplodeWriter: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProbeArchive(t *testing.T) {
+	valid := imploded(t, []byte(strings.Repeat("The quick brown fox. ", 50)))
+	// Literal mode 7 is not a valid DCL header.
+	invalid := []byte{7, 4, 0x12, 0x34, 0x56, 0x78}
+	archive := testArchive(testSig, "README.TXT", valid)
+
+	for _, tc := range []struct {
+		name       string
+		data       []byte
+		recognized bool
+	}{
+		{"valid", archive, true},
+		{"damaged signature", append([]byte("XXX"), archive[3:]...), true},
+		{"truncated header", archive[:6], true},
+		{"truncated data", archive[:len(archive)-len(valid)/2], true},
+		{"data does not decompress", testArchive(testSig, "README.TXT", invalid), true},
+		{"name with control characters and data that does not decompress", testArchive(testSig, "\x01\x02\x1b", invalid), false},
+		{"text file", append(append([]byte{}, testSig...), strings.Repeat("Some notes about the release, in plain text.\r\n", 10)...), false},
+		{"zeros", make([]byte, 100), false},
+		{"zeros after signature", append(append([]byte{}, testSig...), make([]byte, 100)...), true},
+		{"no signature and data that does not decompress", testArchive([]byte("XXX"), "README.TXT", invalid), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cd := ProbeArchive(bytes.NewReader(tc.data), testSig, int64(len(testSig)), readTestHeader)
+			if got := cd.Confidence >= MinConfidence; got != tc.recognized {
+				t.Errorf("confidence %d, recognized = %v, want %v; evidence:\n%s", cd.Confidence, got, tc.recognized, strings.Join(cd.Evidence, "\n"))
+			}
+		})
+	}
+}
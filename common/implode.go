@@ -0,0 +1,283 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	minMatch   = 2                   // Shortest length/distance pair.
+	maxMatch   = endOfStream - 1     // Longest length/distance pair.
+	maxDist2   = 64 << 2             // Farthest distance for a length 2 pair.
+	maxChain   = 128                 // Hash chain entries examined per position.
+	trimAmount = 16 * maxWindow      // History discarded at a time.
+	outBufSize = 4096                // Compressed bytes buffered before writing.
+	noPos      = -1                  // Empty hash chain entry.
+	hashSize   = 1 << 16             // One chain per distinct pair of bytes.
+	lookahead  = maxMatch + minMatch // Input kept back until Close.
+)
+
+// ErrClosed is returned when writing to a closed implode writer.
+var ErrClosed = errors.New("implode: write to closed writer")
+
+// code is a Huffman code ready to be written to the bit stream: the bits are
+// already reversed and inverted as the DCL format expects.
+type code struct {
+	bits uint32
+	len  uint
+}
+
+// encoder returns the codes for every symbol of the decoding table h.
+func (h *huffman) encoder() []code {
+	codes := make([]code, len(h.symbol))
+	first, index := 0, 0
+	for l := 1; l <= maxBits; l++ {
+		for i := 0; i < h.count[l]; i++ {
+			c := first + i
+			var rev uint32
+			for b := 0; b < l; b++ {
+				rev |= uint32((c>>(l-1-b))&1^1) << b
+			}
+			codes[h.symbol[index+i]] = code{bits: rev, len: uint(l)}
+		}
+		index += h.count[l]
+		first = (first + h.count[l]) << 1
+	}
+	return codes
+}
+
+var (
+	litCodes  = litCode.encoder()
+	lenCodes  = lenCode.encoder()
+	distCodes = distCode.encoder()
+
+	// lenSymbol maps each match length to its length code.
+	lenSymbol [endOfStream + 1]int
+)
+
+func init() {
+	for sym, base := range lenBase {
+		for l := base; l < base+1<<lenExtra[sym] && l <= endOfStream; l++ {
+			lenSymbol[l] = sym
+		}
+	}
+}
+
+// implodeWriter compresses data with the PKWARE DCL implode algorithm.
+type implodeWriter struct {
+	w        io.Writer
+	mode     LiteralMode
+	dictBits uint
+	dictSize int
+
+	buf  []byte // History followed by data not yet encoded.
+	base int64  // Absolute position of buf[0].
+	pos  int    // Index in buf of the next byte to encode.
+	head []int64
+	prev []int64 // Previous position with the same pair, indexed by position modulo dictSize.
+
+	bitBuf uint32
+	bitCnt uint
+	out    []byte
+
+	err    error
+	closed bool
+}
+
+// NewImplodeWriter returns a writer that compresses data written to it with
+// the PKWARE DCL implode algorithm and writes the result to w. dictSize must
+// be 1024, 2048 or 4096; larger dictionaries compress better. The output can
+// be read back with NewExplodeReader. Close must be called to write the end
+// of the stream.
+func NewImplodeWriter(w io.Writer, mode LiteralMode, dictSize int) (io.WriteCloser, error) {
+	if mode != LiteralBinary && mode != LiteralASCII {
+		return nil, fmt.Errorf("implode: %w %d", ErrLiteralMode, mode)
+	}
+	var dictBits uint
+	switch dictSize {
+	case 1024:
+		dictBits = 4
+	case 2048:
+		dictBits = 5
+	case 4096:
+		dictBits = 6
+	default:
+		return nil, fmt.Errorf("implode: %w %d", ErrDictionarySize, dictSize)
+	}
+
+	z := &implodeWriter{
+		w:        w,
+		mode:     mode,
+		dictBits: dictBits,
+		dictSize: dictSize,
+		head:     make([]int64, hashSize),
+		prev:     make([]int64, dictSize),
+		out:      make([]byte, 0, outBufSize),
+	}
+	for i := range z.head {
+		z.head[i] = noPos
+	}
+	z.putBits(uint32(mode), 8)
+	z.putBits(uint32(dictBits), 8)
+	return z, nil
+}
+
+// putBits appends the low n bits of v to the output, least significant first.
+func (z *implodeWriter) putBits(v uint32, n uint) {
+	z.bitBuf |= v << z.bitCnt
+	z.bitCnt += n
+	for z.bitCnt >= 8 {
+		z.out = append(z.out, byte(z.bitBuf))
+		z.bitBuf >>= 8
+		z.bitCnt -= 8
+	}
+}
+
+func (z *implodeWriter) putCode(c code) {
+	z.putBits(c.bits, c.len)
+}
+
+// flush writes buffered output to the underlying writer once enough has built up.
+func (z *implodeWriter) flush(force bool) error {
+	if len(z.out) < outBufSize && !force {
+		return nil
+	}
+	if _, err := z.w.Write(z.out); err != nil {
+		return err
+	}
+	z.out = z.out[:0]
+	return nil
+}
+
+// insert adds the pair of bytes at buf index i to the hash chains.
+func (z *implodeWriter) insert(i int) {
+	if i+1 >= len(z.buf) {
+		return
+	}
+	h := int(z.buf[i])<<8 | int(z.buf[i+1])
+	abs := z.base + int64(i)
+	z.prev[abs%int64(z.dictSize)] = z.head[h]
+	z.head[h] = abs
+}
+
+// longestMatch returns the longest earlier match for the data at buf index
+// pos within the dictionary, and its distance.
+func (z *implodeWriter) longestMatch(pos int) (length, dist int) {
+	avail := len(z.buf) - pos
+	if avail < minMatch {
+		return 0, 0
+	}
+	limit := maxMatch
+	if avail < limit {
+		limit = avail
+	}
+
+	abs := z.base + int64(pos)
+	cand := z.head[int(z.buf[pos])<<8|int(z.buf[pos+1])]
+	for n := 0; cand != noPos && n < maxChain; n++ {
+		d := int(abs - cand)
+		if d > z.dictSize || cand < z.base {
+			break
+		}
+		c := int(cand - z.base)
+		l := 0
+		for l < limit && z.buf[c+l] == z.buf[pos+l] {
+			l++
+		}
+		if l > length && (l > minMatch || d <= maxDist2) {
+			length, dist = l, d
+			if l == limit {
+				break
+			}
+		}
+		next := z.prev[cand%int64(z.dictSize)]
+		if next >= cand {
+			break // Stale entry overwritten by a newer position.
+		}
+		cand = next
+	}
+	return length, dist
+}
+
+// encode compresses buffered input until only keep bytes remain unencoded.
+func (z *implodeWriter) encode(keep int) {
+	for len(z.buf)-z.pos > keep {
+		length, dist := z.longestMatch(z.pos)
+		if length < minMatch {
+			b := z.buf[z.pos]
+			z.putBits(0, 1)
+			if z.mode == LiteralASCII {
+				z.putCode(litCodes[b])
+			} else {
+				z.putBits(uint32(b), 8)
+			}
+			z.insert(z.pos)
+			z.pos++
+			continue
+		}
+
+		z.putBits(1, 1)
+		sym := lenSymbol[length]
+		z.putCode(lenCodes[sym])
+		z.putBits(uint32(length-lenBase[sym]), lenExtra[sym])
+
+		lowBits := z.dictBits
+		if length == 2 {
+			lowBits = 2
+		}
+		d := uint32(dist - 1)
+		z.putCode(distCodes[d>>lowBits])
+		z.putBits(d&(1<<lowBits-1), lowBits)
+
+		for i := 0; i < length; i++ {
+			z.insert(z.pos + i)
+		}
+		z.pos += length
+	}
+
+	// Drop history that can no longer be referenced.
+	if z.pos > z.dictSize+trimAmount {
+		n := z.pos - z.dictSize
+		z.buf = append(z.buf[:0], z.buf[n:]...)
+		z.base += int64(n)
+		z.pos -= n
+	}
+}
+
+func (z *implodeWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, ErrClosed
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	z.buf = append(z.buf, p...)
+	z.encode(lookahead)
+	if z.err = z.flush(false); z.err != nil {
+		return 0, z.err
+	}
+	return len(p), nil
+}
+
+// Close compresses any remaining data and writes the end of stream marker. It
+// does not close the underlying writer.
+func (z *implodeWriter) Close() error {
+	if z.closed {
+		return z.err
+	}
+	z.closed = true
+	if z.err != nil {
+		return z.err
+	}
+
+	z.encode(0)
+	z.putBits(1, 1)
+	z.putCode(lenCodes[lenSymbol[endOfStream]])
+	z.putBits(uint32(endOfStream-lenBase[lenSymbol[endOfStream]]), lenExtra[lenSymbol[endOfStream]])
+	if z.bitCnt > 0 {
+		z.putBits(0, 8-z.bitCnt)
+	}
+	z.err = z.flush(true)
+	return z.err
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// roundTripInputs returns data that exercises literals, short and long
+// matches, and distances beyond the smaller dictionary sizes.
+func roundTripInputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 10000)
+	rng.Read(random)
+
+	var text strings.Builder
+	for i := 0; text.Len() < 20000; i++ {
+		fmt.Fprintf(&text, "Line %d of a test file, repeated with small changes.\r\n", i%97)
+	}
+
+	// Blocks that repeat 3000 bytes apart, so only a 4096 byte dictionary
+	// can reach back to them.
+	far := append(append(append([]byte{}, random[:3000]...), random[5000:8000]...), random[:3000]...)
+
+	return map[string][]byte{
+		"empty":  {},
+		"byte":   {'A'},
+		"pair":   []byte("AA"),
+		"run":    bytes.Repeat([]byte{0}, 5000),
+		"text":   []byte(text.String()),
+		"random": random,
+		"far":    far,
+	}
+}
+
+func TestImplodeRoundTrip(t *testing.T) {
+	for _, mode := range []LiteralMode{LiteralBinary, LiteralASCII} {
+		for dictBits, dictSize := range map[byte]int{4: 1024, 5: 2048, 6: 4096} {
+			for name, data := range roundTripInputs() {
+				t.Run(fmt.Sprintf("mode%d/dict%d/%s", mode, dictSize, name), func(t *testing.T) {
+					var comp bytes.Buffer
+					w, err := NewImplodeWriter(&comp, mode, dictSize)
+					if err != nil {
+						t.Fatalf("NewImplodeWriter: %v", err)
+					}
+					if _, err := w.Write(data); err != nil {
+						t.Fatalf("Write: %v", err)
+					}
+					if err := w.Close(); err != nil {
+						t.Fatalf("Close: %v", err)
+					}
+
+					if h := comp.Bytes()[:2]; h[0] != byte(mode) || h[1] != dictBits {
+						t.Errorf("header % x, want %02x %02x", h, byte(mode), dictBits)
+					}
+					got, err := io.ReadAll(NewExplodeReader(&comp))
+					if err != nil {
+						t.Fatalf("explode: %v", err)
+					}
+					if !bytes.Equal(got, data) {
+						t.Errorf("round trip of %d bytes returned %d different bytes", len(data), len(got))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestImplodeWriterOptions(t *testing.T) {
+	if _, err := NewImplodeWriter(io.Discard, LiteralMode(2), 4096); !errors.Is(err, ErrLiteralMode) {
+		t.Errorf("literal mode 2: got error %v, want %v", err, ErrLiteralMode)
+	}
+	if _, err := NewImplodeWriter(io.Discard, LiteralBinary, 8192); !errors.Is(err, ErrDictionarySize) {
+		t.Errorf("dictionary size 8192: got error %v, want %v", err, ErrDictionarySize)
+	}
+
+	w, err := NewImplodeWriter(io.Discard, LiteralBinary, 4096)
+	if err != nil {
+		t.Fatalf("NewImplodeWriter: %v", err)
+	}
+	w.Close()
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close: got error %v, want %v", err, ErrClosed)
+	}
+}
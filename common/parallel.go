@@ -0,0 +1,81 @@
+package common
+
+import "io"
+
+// ParallelReader is a MemberReader that decompresses members concurrently,
+// ahead of the caller. The member boundaries must already be known, as
+// returned by Format.List, and the archive is read through io.ReaderAt so
+// that every member can be read independently of the others.
+type ParallelReader struct {
+	ra      io.ReaderAt
+	format  string
+	headers []Header
+	members []int                // Indexes of the selected members in headers.
+	ahead   int                  // Number of members decompressed ahead of the caller.
+	results []chan *decompressed // Decompressed data of each member started so far.
+	n       int                  // Number of members returned by Next so far.
+}
+
+// NewParallelReader returns a ParallelReader for the members described by
+// headers that keep selects, or all of them if keep is nil, decompressing up
+// to n of them at once. Members that are not selected are never read. format
+// is the format name used in errors. The decompressed data of up to n members
+// is held in memory.
+func NewParallelReader(ra io.ReaderAt, format string, headers []Header, n int, keep SelectFunc) *ParallelReader {
+	r := &ParallelReader{ra: ra, format: format, headers: headers, ahead: max(n, 1)}
+	for i := range headers {
+		if keep == nil || keep(i, &headers[i]) {
+			r.members = append(r.members, i)
+		}
+	}
+	return r
+}
+
+// Next returns the next member in archive order, waiting for it to be
+// decompressed if needed. Errors found while decompressing are returned by
+// the data reader after any data that was decompressed before them, as for
+// the sequential readers.
+func (r *ParallelReader) Next() (*Header, io.Reader, error) {
+	if r.n == len(r.members) {
+		return nil, nil, io.EOF
+	}
+	for len(r.results) < len(r.members) && len(r.results) < r.n+r.ahead {
+		r.start(r.members[len(r.results)])
+	}
+	h := &r.headers[r.members[r.n]]
+	d := <-r.results[r.n]
+	r.results[r.n] = nil
+	r.n++
+	return h, d, nil
+}
+
+// start decompresses member i in the background. The result channel is
+// buffered so that the goroutine finishes even if the member is never read.
+func (r *ParallelReader) start(i int) {
+	ch := make(chan *decompressed, 1)
+	r.results = append(r.results, ch)
+	h := &r.headers[i]
+	go func() {
+		section := io.NewSectionReader(r.ra, h.Offset, int64(h.CompressedSize))
+		data, err := io.ReadAll(NewMemberReader(section, r.format, i, h))
+		ch <- &decompressed{data: data, err: err}
+	}()
+}
+
+// decompressed is the data of a member decompressed ahead of time.
+type decompressed struct {
+	data []byte
+	err  error // Error that ended decompression, returned after data.
+}
+
+func (d *decompressed) Read(p []byte) (int, error) {
+	if len(d.data) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, d.data)
+	d.data = d.data[n:]
+	return n, nil
+}
@@ -0,0 +1,187 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingReaderAt is an io.ReaderAt that records the offsets read from.
+type recordingReaderAt struct {
+	ra  io.ReaderAt
+	mu  sync.Mutex
+	off []int64
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	r.off = append(r.off, off)
+	r.mu.Unlock()
+	return r.ra.ReadAt(p, off)
+}
+
+// readAt reports whether any read started within the data of h.
+func (r *recordingReaderAt) readAt(h *Header) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, off := range r.off {
+		if off >= h.Offset && off < h.Offset+int64(h.CompressedSize) {
+			return true
+		}
+	}
+	return false
+}
+
+// parallelArchive returns an archive in testFormat with the given number of
+// members, where member i is called M<i> and holds memberData(i), and its
+// headers.
+func parallelArchive(t *testing.T, members int) ([]byte, []Header) {
+	t.Helper()
+	b := append([]byte{}, testSig...)
+	for i := 0; i < members; i++ {
+		b = append(b, testArchive(nil, fmt.Sprintf("M%d", i), imploded(t, memberData(i)))...)
+	}
+	headers, err := testFormat{}.List(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return b, headers
+}
+
+// memberData returns the data of member i of a parallelArchive, of a different
+// length for each member.
+func memberData(i int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("member %d. ", i)), 100*(i+1))
+}
+
+// readAll reads every member of r and returns their names and data.
+func readAll(t *testing.T, r MemberReader) (names []string, data [][]byte) {
+	t.Helper()
+	for {
+		h, d, err := r.Next()
+		if err == io.EOF {
+			return names, data
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		b, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("reading %s: %v", h.Filename, err)
+		}
+		names = append(names, h.Filename)
+		data = append(data, b)
+	}
+}
+
+// sequentialReader reads the members described by headers from b in order,
+// as the format readers do.
+type sequentialReader struct {
+	b       []byte
+	headers []Header
+	n       int
+}
+
+func (r *sequentialReader) Next() (*Header, io.Reader, error) {
+	if r.n == len(r.headers) {
+		return nil, nil, io.EOF
+	}
+	h := &r.headers[r.n]
+	r.n++
+	return h, NewMemberReader(bytes.NewReader(r.b[h.Offset:h.Offset+int64(h.CompressedSize)]), "TST", r.n-1, h), nil
+}
+
+func TestParallelReader(t *testing.T) {
+	b, headers := parallelArchive(t, 9)
+	odd := func(i int, h *Header) bool { return i%2 == 1 }
+
+	for _, tc := range []struct {
+		name string
+		n    int
+		keep SelectFunc
+	}{
+		{"one at a time", 1, nil},
+		{"four at a time", 4, nil},
+		{"more than the members", 20, nil},
+		{"selected", 3, odd},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var seq MemberReader = &sequentialReader{b: b, headers: headers}
+			if tc.keep != nil {
+				seq = Select(seq, tc.keep)
+			}
+			wantNames, wantData := readAll(t, seq)
+
+			ra := &recordingReaderAt{ra: bytes.NewReader(b)}
+			gotNames, gotData := readAll(t, NewParallelReader(ra, "TST", headers, tc.n, tc.keep))
+			if fmt.Sprint(gotNames) != fmt.Sprint(wantNames) {
+				t.Errorf("members = %v, want %v", gotNames, wantNames)
+			}
+			for i := range wantData {
+				if i < len(gotData) && !bytes.Equal(gotData[i], wantData[i]) {
+					t.Errorf("member %s holds %d bytes that differ from the %d read in order", wantNames[i], len(gotData[i]), len(wantData[i]))
+				}
+			}
+
+			// Members that are not selected are never read.
+			for i := range headers {
+				selected := tc.keep == nil || tc.keep(i, &headers[i])
+				if got := ra.readAt(&headers[i]); got != selected {
+					t.Errorf("member %d read = %v, want %v", i, got, selected)
+				}
+			}
+		})
+	}
+}
+
+// waitForGoroutines waits for the number of goroutines to fall to n.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running, want %d", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParallelReaderError(t *testing.T) {
+	b, headers := parallelArchive(t, 6)
+	b[headers[2].Offset] = 7 // Literal mode 7 is invalid.
+	before := runtime.NumGoroutine()
+
+	r := NewParallelReader(bytes.NewReader(b), "TST", headers, 4, nil)
+	for i := range headers {
+		h, d, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		data, err := io.ReadAll(d)
+		var fe *FormatError
+		switch {
+		case i != 2 && err != nil:
+			t.Errorf("member %s: %v", h.Filename, err)
+		case i != 2 && !bytes.Equal(data, memberData(i)):
+			t.Errorf("member %s holds the wrong data", h.Filename)
+		case i == 2 && (!errors.As(err, &fe) || fe.Kind != ErrDecompress || fe.Member != 2 || fe.Format != "TST"):
+			t.Errorf("member %s error = %v, want a TST decompression error for member 2", h.Filename, err)
+		}
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next after the last member = %v, want io.EOF", err)
+	}
+	waitForGoroutines(t, before)
+
+	// Members decompressed ahead are not leaked if the caller stops early.
+	r = NewParallelReader(bytes.NewReader(b), "TST", headers, 4, nil)
+	if _, _, err := r.Next(); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	waitForGoroutines(t, before)
+}
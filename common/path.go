@@ -0,0 +1,32 @@
+package common
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SanitizePath converts a member name read from an archive into a relative,
+// slash-separated path that cannot escape the directory it is extracted into.
+// Backslash separators are converted, and DOS drive letters, leading
+// separators, "." and ".." components are removed, and any remaining colons are
+// replaced so they cannot select a drive or stream on Windows. The result is returned in
+// the host's path syntax and is empty if nothing usable remains.
+func SanitizePath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+
+	// Drop a DOS drive letter such as "C:".
+	if len(name) >= 2 && name[1] == ':' {
+		name = name[2:]
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".", "..":
+			continue
+		}
+		parts = append(parts, strings.ReplaceAll(part, ":", "_"))
+	}
+	return filepath.FromSlash(path.Join(parts...))
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitizePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // Slash-separated; converted to the host's syntax.
+	}{
+		{"README.TXT", "README.TXT"},
+		{`DOS\README.TXT`, "DOS/README.TXT"},
+		{`..\..\x`, "x"},
+		{"../../x", "x"},
+		{`a\..\..\x`, "a/x"},
+		{"/abs", "abs"},
+		{`\abs`, "abs"},
+		{"C:x", "x"},
+		{`C:\a\..\b`, "a/b"},
+		{`C:\WINDOWS\WIN.COM`, "WINDOWS/WIN.COM"},
+		{`\\srv\share\x`, "srv/share/x"},
+		{"//srv/share/x", "srv/share/x"},
+		{"foo:bar.txt", "foo_bar.txt"},
+		{"file.txt:stream", "file.txt_stream"},
+		{`DIR\C:x`, "DIR/C_x"},
+		{"C:D:x", "D_x"},
+		{`.\.\x`, "x"},
+		{"", ""},
+		{"..", ""},
+		{`C:\`, ""},
+	}
+	for _, tt := range tests {
+		if got, want := SanitizePath(tt.name), filepath.FromSlash(tt.want); got != want {
+			t.Errorf("SanitizePath(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package common
+
+import (
+	"fmt"
+	"io"
+)
+
+// MemberReader provides sequential access to the members of an archive, in the
+// style of archive/tar.Reader.
+type MemberReader interface {
+	// Next advances to the next member and returns its header and a reader for
+	// its decompressed data. Any unread data of the previous member is skipped.
+	// Next returns io.EOF once there are no more members.
+	Next() (*Header, io.Reader, error)
+}
+
+// SelectFunc reports whether the i'th member of an archive, counting from
+// zero, should be read.
+type SelectFunc func(i int, h *Header) bool
+
+// Select returns a MemberReader that returns only the members of r that keep
+// selects. The data of the other members is never read, so the format readers
+// seek over it without decompressing it.
+func Select(r MemberReader, keep SelectFunc) MemberReader {
+	return &selectReader{r: r, keep: keep}
+}
+
+type selectReader struct {
+	r    MemberReader
+	keep SelectFunc
+	n    int // Number of members read from r so far.
+}
+
+func (s *selectReader) Next() (*Header, io.Reader, error) {
+	for {
+		h, data, err := s.r.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		s.n++
+		if s.keep(s.n-1, h) {
+			return h, data, nil
+		}
+	}
+}
+
+// blastStream decompresses a single member on demand.
+type blastStream struct {
+	r          io.Reader
+	compSize   uint32
+	decompSize uint32
+	dec        io.Reader
+	n          int64 // decompressed bytes returned so far
+	err        error // sticky error
+
+	// Context for errors, see FormatError.
+	format string
+	member int
+	offset int64
+}
+
+// NewBlastReader returns a reader that decompresses compSize bytes of DCL
+// compressed data read from rs. Nothing is read from rs until the first call
+// to Read. If decompSize is non-zero, reading fails unless the data
+// decompresses to exactly that many bytes. Errors are reported as
+// *FormatError.
+func NewBlastReader(rs io.Reader, compSize, decompSize uint32) io.ReadCloser {
+	return &blastStream{r: rs, compSize: compSize, decompSize: decompSize, member: -1, offset: -1}
+}
+
+// NewMemberReader is like NewBlastReader for the member described by h, the
+// member'th of an archive in the named format, and reports errors with that
+// context.
+func NewMemberReader(rs io.Reader, format string, member int, h *Header) io.ReadCloser {
+	return &blastStream{r: rs, compSize: h.CompressedSize, decompSize: h.DecompressedSize, format: format, member: member, offset: h.Offset}
+}
+
+func (s *blastStream) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.dec == nil {
+		s.dec = NewExplodeReader(&compressedInput{r: s.r, left: int64(s.compSize)})
+	}
+
+	n, err := s.dec.Read(p)
+	s.n += int64(n)
+	switch {
+	case s.decompSize != 0 && s.n > int64(s.decompSize):
+		err = s.fail(ErrDecompress, fmt.Errorf("size mismatch: got more than the expected %d bytes", s.decompSize))
+	case err == io.EOF && s.decompSize != 0 && s.n != int64(s.decompSize):
+		err = s.fail(ErrDecompress, fmt.Errorf("size mismatch: read %d of %d bytes", s.n, s.decompSize))
+	case err != nil && err != io.EOF:
+		err = NewFormatError(s.format, s.member, s.offset, ErrDecompress, fmt.Errorf("read %d bytes: %w", s.n, err))
+	}
+	s.err = err
+	return n, err
+}
+
+// fail returns a FormatError of the given kind for this member.
+func (s *blastStream) fail(kind, err error) error {
+	return &FormatError{Format: s.format, Member: s.member, Offset: s.offset, Kind: kind, Err: err}
+}
+
+// Close stops decompression. It does not close the underlying reader.
+func (s *blastStream) Close() error {
+	s.err = io.ErrClosedPipe
+	return nil
+}
+
+// compressedInput limits reads to a member's compressed size and reports
+// io.ErrUnexpectedEOF if the archive ends before all of it has been read.
+type compressedInput struct {
+	r    io.Reader
+	left int64
+}
+
+func (in *compressedInput) Read(p []byte) (int, error) {
+	if in.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > in.left {
+		p = p[:in.left]
+	}
+	n, err := in.r.Read(p)
+	in.left -= int64(n)
+	if err == io.EOF && in.left > 0 {
+		err = fmt.Errorf("reading compressed data: %w", io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
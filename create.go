@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// create implements the "create" command, which builds a new archive from
+// files on disk.
+func create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	formatName := fs.String("f", "", "archive `format` to create, e.g. cmz")
+	ascii := fs.Bool("ascii", false, "use the DCL ASCII literal mode, which suits text files")
+	dictSize := fs.Int("dict", 4096, "DCL dictionary `size`: 1024, 2048 or 4096")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dclextract create -f <format> [options] <archive> <file>...\n")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if *formatName == "" || fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+
+	ft, ok := c.LookupName(*formatName)
+	if !ok {
+		return fmt.Errorf("unknown archive format %q", *formatName)
+	}
+	format, _ := c.Lookup(ft)
+	creator, ok := format.(c.Creator)
+	if !ok {
+		return fmt.Errorf("creating %s archives is not supported", format.Name())
+	}
+
+	mode := c.LiteralBinary
+	if *ascii {
+		mode = c.LiteralASCII
+	}
+
+	archivePath := fs.Arg(0)
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	aw := creator.NewWriter(out, mode, *dictSize)
+
+	err = addFiles(aw, fs.Args()[1:])
+	if closeErr := aw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+	fmt.Printf("Created %s archive %s with %d file(s)\n", format.Name(), archivePath, fs.NArg()-1)
+	return nil
+}
+
+// addFiles adds each file to the archive under its base name.
+func addFiles(aw c.ArchiveWriter, paths []string) error {
+	for _, path := range paths {
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		fi, err := in.Stat()
+		var w io.Writer
+		if err == nil {
+			w, err = aw.CreateHeader(&c.Header{Filename: filepath.Base(path), ModTime: fi.ModTime()})
+		}
+		if err == nil {
+			_, err = io.Copy(w, in)
+		}
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", path, err)
+		}
+		fmt.Printf("Added %s\n", path)
+	}
+	return nil
+}
@@ -1,133 +1,228 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
-	"strings"
-
-	"github.com/sourcekris/dclextract/cmz"
-	"github.com/sourcekris/dclextract/nsk"
-	"github.com/sourcekris/dclextract/tsc"
-	"github.com/sourcekris/dclextract/zar"
 
+	"github.com/sourcekris/dclextract/archive"
 	c "github.com/sourcekris/dclextract/common"
 )
 
-func extract(archivePath string) ([]c.ExtractedFileData, error) {
-	f, err := os.Open(archivePath)
+// stdinPath is the archive path that reads an archive from standard input.
+const stdinPath = "-"
+
+// openArchive opens the archive at archivePath and reports its format. If
+// archivePath is stdinPath the archive is read from standard input: streamed
+// if stream is set and the format allows it, and otherwise read into a
+// temporary file. The archive must be closed by the caller.
+func openArchive(out *reporter, archivePath string, stream bool) (*archive.Archive, error) {
+	var (
+		a   *archive.Archive
+		err error
+	)
+	switch {
+	case archivePath == stdinPath && stream:
+		a, err = archive.OpenStream(os.Stdin)
+	case archivePath == stdinPath:
+		a, err = archive.OpenReader(os.Stdin)
+	default:
+		a, err = archive.Open(archivePath)
+	}
+	if errors.Is(err, archive.ErrUnknownFormat) {
+		out.printf("Detected file type: %s\n", c.TypeUnknown)
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-
-	var results []c.ExtractedFileData
 
-	fileSize, err := f.Seek(0, io.SeekEnd)
-	if err != nil {
-		return nil, fmt.Errorf("could not determine file size: %w", err)
+	if len(a.Paths) > 1 {
+		out.printf("Detected file type: %s (%d volumes)\n", a.Format.Name(), len(a.Paths))
+	} else {
+		out.printf("Detected file type: %s\n", a.Format.Name())
 	}
-	if _, err := f.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("could not seek to start: %w", err)
+	return a, nil
+}
+
+// Exit codes. Problems with the contents of an archive are reported with a
+// code for each kind of c.FormatError, starting above 2, which the Go runtime
+// uses for a panic.
+const (
+	exitError         = 1 // Usage, I/O and other errors.
+	exitCorruptHeader = 3
+	exitTruncated     = 4
+	exitBadMagic      = 5
+	exitDecompress    = 6
+)
+
+// exitCode returns the process exit code for err.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, c.ErrCorruptHeader):
+		return exitCorruptHeader
+	case errors.Is(err, c.ErrTruncated):
+		return exitTruncated
+	case errors.Is(err, c.ErrBadMagic):
+		return exitBadMagic
+	case errors.Is(err, c.ErrDecompress):
+		return exitDecompress
 	}
+	return exitError
+}
 
-	// Read header and footer chunks for file type detection.
-	header := make([]byte, c.MaxSignatureLength)
-	n, readErr := f.Read(header)
-	if readErr != nil && readErr != io.EOF {
-		return nil, readErr
+// parseFlags parses args into fs, which must use flag.ContinueOnError. Like
+// flag.ExitOnError it exits with status 0 for -h, but invalid flags exit with
+// exitError rather than 2.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	switch err := fs.Parse(args); {
+	case err == flag.ErrHelp:
+		os.Exit(0)
+	case err != nil:
+		os.Exit(exitError)
 	}
-	header = header[:n] // Slice to actual bytes read
+}
 
-	var footer []byte
-	if fileSize >= int64(c.MaxSignatureLength) {
-		footer = make([]byte, c.MaxSignatureLength)
-		n, readAtErr := f.ReadAt(footer, fileSize-int64(c.MaxSignatureLength))
-		if readAtErr != nil && readAtErr != io.EOF {
-			footer = nil // Non-fatal, clear the footer on error
-		} else {
-			footer = footer[:n]
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: dclextract [options] <filename> [<member pattern>...]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       dclextract [options] [-r] <path>...\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       dclextract create -f <format> [options] <archive> <file>...\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "create" {
+		if err := create(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating archive:", err)
+			os.Exit(exitError)
 		}
+		return
 	}
 
-	fileType := c.DetermineFileType(header, footer)
-	fmt.Printf("Detected file type: %s\n", fileType)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	listMode := flag.Bool("l", false, "list archive contents without extracting")
+	testMode := flag.Bool("t", false, "test archive integrity without writing any files")
+	outputDir := flag.String("d", ".", "extract files into `dir`, creating it if needed")
+	overwrite := archive.OverwriteAlways
+	flag.Var(&overwrite, "overwrite", "`policy` for existing files: never, always, rename or newer")
+	applyAttrs := flag.Bool("attrs", false, "apply stored file attributes, making read-only members read-only (0444)")
+	jsonOutput := flag.Bool("json", false, "print one JSON record per member and a summary record instead of text")
+	recursive := flag.Bool("r", false, "search directories for archives, extracting each into its own subdirectory")
+	jobs := flag.Int("j", 1, "process up to `n` archives at once in batch mode")
+	parallel := flag.Int("parallel", 1, "decompress up to `n` members of each archive at once when extracting")
+	identifyMode := flag.Bool("identify", false, "print the likely formats of each file with a confidence score instead of extracting")
+	pipePattern := flag.String("p", "", "write the members matching `pattern` to standard output instead of extracting")
+	var includes, excludes patternList
+	flag.Var(&includes, "include", "process only members matching `pattern`; may be repeated")
+	flag.Var(&excludes, "exclude", "skip members matching `pattern`; may be repeated")
+	index := flag.Int("index", 0, "process the member at position `n`, counting from 1")
+	flag.Usage = usage
+	parseFlags(flag.CommandLine, os.Args[1:])
+
+	// Keep standard output for member data when piping.
+	if *pipePattern != "" {
+		console.w = os.Stderr
+	}
+	if *jsonOutput {
+		console.setJSON()
+	}
 
-	if _, err := f.Seek(0, io.SeekStart); err != nil {
-		return nil, err
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(exitError)
 	}
 
-	switch fileType {
-	case c.TypeCMZ:
-		results, err = cmz.Extract(f)
-	case c.TypeNSK:
-		results, err = nsk.Extract(f)
-	case c.TypeTSC:
-		results, err = tsc.Extract(f)
-	case c.TypeZAR:
-		results, err = zar.Extract(f)
-	default:
-		return nil, fmt.Errorf("unknown file type for %s", archivePath)
+	sel := &selection{patterns: includes, excludes: excludes, index: *index}
+	args := withoutVolumes(flag.Args())
+
+	if *pipePattern != "" {
+		// As when extracting, the arguments after the archive are member
+		// patterns unless they name further archives.
+		paths := args[:1]
+		if isBatch(args, false) {
+			archives, err := findArchives(args, false)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(exitCode(err))
+			}
+			paths = nil
+			for _, a := range archives {
+				paths = append(paths, a.path)
+			}
+		} else {
+			sel.patterns = append(sel.patterns, args[1:]...)
+		}
+		for _, path := range paths {
+			if err := pipe(console, os.Stdout, path, *pipePattern, sel); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+				os.Exit(exitCode(err))
+			}
+		}
+		return
 	}
 
-	if err != nil {
-		// If results has some items, it means a partial extraction succeeded before an error.
-		// The caller (main) can decide what to do. Here, we return partial results + error.
-		return results, err
+	if *identifyMode {
+		var firstErr error
+		for _, path := range args {
+			if err := identify(console, path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error identifying %s: %v\n", path, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		if firstErr != nil {
+			os.Exit(exitCode(firstErr))
+		}
+		return
 	}
-	return results, nil
-}
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: extract <filename>")
-		os.Exit(1)
+	if isBatch(args, *recursive) {
+		b := &batch{
+			listMode:  *listMode,
+			testMode:  *testMode,
+			outputDir: *outputDir,
+			extractor: extractor{overwrite: overwrite, applyAttrs: *applyAttrs, parallel: *parallel, sel: sel},
+			jobs:      *jobs,
+			sel:       sel,
+		}
+		if err := b.run(args, *recursive); err != nil {
+			os.Exit(exitCode(err))
+		}
+		return
 	}
-	inputFilename := os.Args[1]
-	extractedItems, err := extract(inputFilename)
+	inputFilename := args[0]
+	sel.patterns = append(sel.patterns, args[1:]...)
 
-	if err != nil {
-		// Print error, but continue if there are partial results to write
-		fmt.Fprintln(os.Stderr, "Error during extraction:", err)
-		if len(extractedItems) == 0 { // No partial results, so exit
-			os.Exit(1)
+	if *listMode {
+		if err := list(console, inputFilename, sel); err != nil {
+			fmt.Fprintln(os.Stderr, "Error listing archive:", err)
+			os.Exit(exitCode(err))
 		}
-		fmt.Fprintln(os.Stderr, "Attempting to write any partially extracted files...")
+		return
 	}
 
-	if len(extractedItems) == 0 {
-		if err == nil { // No error, but no files found
-			fmt.Println("No files found to extract from the archive.")
+	if *testMode {
+		failures, err := test(console, inputFilename, sel)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error testing archive:", err)
+			os.Exit(exitCode(err))
 		}
-		os.Exit(0) // Exit if no files, even if there was a non-fatal error reported above
-	}
-
-	// Write the extracted files to disk.
-	defaultFileCounter := 0
-	for i, item := range extractedItems {
-		outputDestFilename := item.Filename
-		if outputDestFilename == "" {
-			base := filepath.Base(inputFilename)
-			fileExt := filepath.Ext(base)
-			baseName := strings.TrimSuffix(base, fileExt)
-			if baseName == "" {
-				baseName = "extracted_file"
-			}
-			outputDestFilename = fmt.Sprintf("%s_%d", baseName, defaultFileCounter)
-			if len(extractedItems) == 1 && i == 0 { // Only one file, and it's this one.
-				outputDestFilename = baseName // Use simpler name if only one nameless file.
-			}
-			defaultFileCounter++
-			fmt.Printf("No filename found in archive for item %d, using generated name: %s\n", i+1, outputDestFilename)
+		if len(failures) > 0 {
+			os.Exit(exitCode(failures[0]))
 		}
+		return
+	}
 
-		writeErr := os.WriteFile(outputDestFilename, item.Data, 0644)
-		if writeErr != nil {
-			fmt.Fprintf(os.Stderr, "Error writing data to file %s: %v\n", outputDestFilename, writeErr)
-			// Optionally, set a flag here to exit with error code later if any write fails.
-		} else {
-			fmt.Printf("Successfully extracted %s (compressed: %d bytes, uncompressed: %d bytes) to %s\n", item.Filename, item.CompressedSize, item.DecompressedSize, outputDestFilename)
-		}
+	x := &extractor{outputDir: *outputDir, overwrite: overwrite, applyAttrs: *applyAttrs, parallel: *parallel, sel: sel}
+	written, err := x.extract(console, inputFilename)
+	if err != nil {
+		// Files written before the error are kept, but the exit code still
+		// reports what went wrong.
+		fmt.Fprintln(os.Stderr, "Error during extraction:", err)
+		os.Exit(exitCode(err))
+	}
+	if written == 0 && x.skipped == 0 {
+		console.printf("No files found to extract from the archive.\n")
 	}
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sourcekris/dclextract/cmz"
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// runMainEnv is set in the environment of the test binary started by runCLI
+// to make it run main instead of the tests.
+const runMainEnv = "DCLEXTRACT_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs dclextract with args in dir and returns its standard output,
+// standard error and exit status.
+func runCLI(t *testing.T, dir string, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("running dclextract: %v", err)
+	}
+	return out.String(), errOut.String(), cmd.ProcessState.ExitCode()
+}
+
+// memberTime is the modification time of the members of archives built by
+// cmzArchive.
+var memberTime = time.Date(1994, time.March, 1, 10, 20, 30, 0, time.Local)
+
+// contents returns the data of the member called name in the archives built
+// by cmzArchive and zarArchive.
+func contents(name string) string {
+	return "contents of " + name
+}
+
+// cmzArchive returns a CMZ archive with a member for each name, holding
+// contents(name) and modified at memberTime.
+func cmzArchive(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := cmz.NewWriter(&buf)
+	for _, name := range names {
+		mw, err := w.CreateHeader(&c.Header{Filename: name, ModTime: memberTime})
+		if err != nil {
+			t.Fatalf("Create(%q): %v", name, err)
+		}
+		if _, err := mw.Write([]byte(contents(name))); err != nil {
+			t.Fatalf("writing %q: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// zarMember is a member of an archive built by zarArchive.
+type zarMember struct {
+	name string
+	attr byte // Attribute bits stored in the high nibble of the name length.
+}
+
+// zarArchive returns a ZAR archive made by version 2.6 with the given
+// configuration word, holding contents(name) for each member.
+func zarArchive(t *testing.T, config uint16, members ...zarMember) []byte {
+	t.Helper()
+	var data, toc []byte
+	for _, m := range members {
+		var buf bytes.Buffer
+		w, err := c.NewImplodeWriter(&buf, c.LiteralBinary, 1024)
+		if err != nil {
+			t.Fatalf("NewImplodeWriter: %v", err)
+		}
+		if _, err := w.Write([]byte(contents(m.name))); err != nil {
+			t.Fatalf("compressing: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("compressing: %v", err)
+		}
+		data = append(data, buf.Bytes()...)
+		toc = append(toc, m.attr<<4|byte(len(m.name)))
+		toc = append(toc, m.name...)
+		toc = binary.LittleEndian.AppendUint32(toc, uint32(buf.Len()))
+	}
+	b := append(data, toc...)
+	b = binary.LittleEndian.AppendUint16(b, config)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(toc)))
+	return append(b, 'P', 'T', '&')
+}
+
+// writeFile writes data to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		kind error
+		want int
+	}{
+		{c.ErrCorruptHeader, exitCorruptHeader},
+		{c.ErrTruncated, exitTruncated},
+		{c.ErrBadMagic, exitBadMagic},
+		{c.ErrDecompress, exitDecompress},
+	} {
+		err := &c.FormatError{Format: "CMZ", Member: 1, Offset: 42, Kind: tc.kind, Err: errors.New("broken")}
+		if got := exitCode(err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d, want %d", err, got, tc.want)
+		}
+		if got := exitCode(fmt.Errorf("reading archive: %w", err)); got != tc.want {
+			t.Errorf("exitCode of wrapped %v = %d, want %d", err, got, tc.want)
+		}
+		if tc.want <= 2 {
+			t.Errorf("exit code %d for %v is used by the Go runtime", tc.want, tc.kind)
+		}
+	}
+	if got := exitCode(os.ErrNotExist); got != exitError {
+		t.Errorf("exitCode(%v) = %d, want %d", os.ErrNotExist, got, exitError)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "GOOD.CMZ", cmzArchive(t, "A.TXT"))
+	bad := cmzArchive(t, "A.TXT")
+	writeFile(t, dir, "TRUNC.CMZ", bad[:len(bad)-4])
+	writeFile(t, dir, "NOTES.TXT", []byte("Some notes about the release, in plain text.\r\n"))
+
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-l", "GOOD.CMZ"}, 0},
+		{[]string{"-h"}, 0},
+		{nil, exitError},
+		{[]string{"-overwrite=bad", "GOOD.CMZ"}, exitError},
+		{[]string{"-bogus", "GOOD.CMZ"}, exitError},
+		{[]string{"create", "-bogus", "NEW.CMZ", "NOTES.TXT"}, exitError},
+		{[]string{"create", "NEW.CMZ"}, exitError},
+		{[]string{"-l", "MISSING.CMZ"}, exitError},
+		{[]string{"-t", "TRUNC.CMZ"}, exitTruncated},
+		{[]string{"-l", "NOTES.TXT"}, exitBadMagic},
+	} {
+		if _, stderr, status := runCLI(t, dir, tc.args...); status != tc.want {
+			t.Errorf("dclextract %q exited with %d, want %d; stderr:\n%s", tc.args, status, tc.want, stderr)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sourcekris/dclextract/archive"
+)
+
+// extractor writes archive members to disk.
+type extractor struct {
+	outputDir  string
+	overwrite  archive.OverwritePolicy
+	applyAttrs bool // Make members stored as read-only read-only on disk.
+	parallel   int  // Number of members decompressed at once; 1 or less streams them in order.
+	sel        *selection
+
+	skipped int // Members not written because of the overwrite policy.
+}
+
+// extract streams every member of the archive at archivePath to disk and
+// returns the number of files written. Extraction stops at the first error;
+// files written before it are kept. Archives read from standard input are
+// streamed if their format allows it.
+func (x *extractor) extract(out *reporter, archivePath string) (written int, err error) {
+	sum := newSummary(archivePath, "extract")
+	defer func() { sum.done(out, err) }()
+
+	a, err := openArchive(out, archivePath, true)
+	if err != nil {
+		return 0, err
+	}
+	defer a.Close()
+	sum.FileType = a.Format.Name()
+
+	opts := &archive.Options{
+		Overwrite:       x.overwrite,
+		ApplyAttributes: x.applyAttrs,
+		Parallel:        x.parallel,
+		Select:          x.sel.selectFunc(),
+		Progress: func(res *archive.Result) {
+			sum.Members++
+			x.report(out, archivePath, a, res, sum)
+		},
+	}
+	return a.ExtractTo(x.outputDir, opts)
+}
+
+// report prints the outcome of extracting one member and adds it to sum.
+func (x *extractor) report(out *reporter, archivePath string, a *archive.Archive, res *archive.Result, sum *summaryRecord) {
+	h := res.Header
+	rec := newMemberRecord(archivePath, a.Format, h)
+	switch {
+	case res.Generated:
+		out.printf("No filename found in archive for item %d, using generated name: %s\n", res.Index+1, res.Name)
+	case res.Name != h.Filename:
+		out.printf("Mapped archive path %q for item %d to: %s\n", h.Filename, res.Index+1, res.Name)
+	}
+
+	switch {
+	case res.Err != nil:
+		rec.fail(res.Err)
+		out.record(rec)
+		sum.Failed++
+	case res.Skipped != "":
+		out.printf("Skipped %s: %s\n", h.Filename, res.Skipped)
+		x.skipped++
+		sum.Skipped++
+		rec.Status, rec.Reason = "skipped", res.Skipped
+		out.record(rec)
+	default:
+		for _, w := range res.Warnings {
+			fmt.Fprintln(os.Stderr, "Error", w)
+		}
+		rec.Output, rec.DecompressedSize, rec.SHA256 = res.Path, res.Size, res.SHA256
+		out.record(rec)
+		out.printf("Successfully extracted %s (compressed: %d bytes, uncompressed: %d bytes) to %s\n", h.Filename, h.CompressedSize, res.Size, res.Path)
+	}
+}
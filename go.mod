@@ -1,13 +1,3 @@
 module github.com/sourcekris/dclextract
 
 go 1.21.1
-
-require (
-	github.com/sourcekris/dclextract/cmz v0.0.0-20250615080000-4fe19d6e7fb0
-	github.com/sourcekris/dclextract/common v0.0.0-20250628120048-2a1c9fed8a73
-	github.com/sourcekris/dclextract/nsk v0.0.0-20250615080223-824a240a6538
-	github.com/sourcekris/dclextract/tsc v0.0.0-20250622034743-ead442c09503
-	github.com/sourcekris/dclextract/zar v0.0.0-20250622083058-cfbf23bcb428
-)
-
-require github.com/JoshVarga/blast v0.0.0-20210808061142-eadad17358e8 // indirect
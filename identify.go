@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	c "github.com/sourcekris/dclextract/common"
+	"github.com/sourcekris/dclextract/zar"
+)
+
+// identify prints the formats the file at path may be in, most likely first,
+// with the evidence for each. The volumes of a spanned archive are examined
+// together. It returns an error if no format is likely enough for the file to
+// be treated as an archive.
+func identify(out *reporter, path string) error {
+	var (
+		f     io.ReadSeekCloser
+		err   error
+		label = path
+	)
+	if volumes := archiveVolumes(path); len(volumes) > 1 {
+		f, err = zar.OpenVolumes(volumes)
+		label = fmt.Sprintf("%s (%d volumes)", path, len(volumes))
+	} else {
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	candidates, err := c.Identify(f)
+	if err != nil {
+		return err
+	}
+
+	rec := &identifyRecord{Type: "identify", Archive: path, Candidates: []candidateRecord{}}
+	out.printf("%s:\n", label)
+	for _, cd := range candidates {
+		rec.Candidates = append(rec.Candidates, candidateRecord{FileType: cd.Type.String(), Confidence: cd.Confidence, Evidence: cd.Evidence})
+		out.printf("  %-4s %3d%%\n", cd.Type, cd.Confidence)
+		for _, e := range cd.Evidence {
+			out.printf("         %s\n", e)
+		}
+	}
+	out.record(rec)
+
+	if len(candidates) == 0 || candidates[0].Confidence < c.MinConfidence {
+		out.printf("  Not a recognized archive.\n")
+		return &c.FormatError{Member: -1, Offset: -1, Kind: c.ErrBadMagic, Err: fmt.Errorf("unknown file type for %s", path)}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// list prints the members of the archive at archivePath that sel selects
+// without decompressing them.
+func list(out *reporter, archivePath string, sel *selection) (err error) {
+	sum := newSummary(archivePath, "list")
+	defer func() { sum.done(out, err) }()
+
+	a, err := openArchive(out, archivePath, false)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	sum.FileType = a.Format.Name()
+
+	all, listErr := a.List()
+	var headers []c.Header
+	for i := range all {
+		if sel.keep(i, &all[i]) {
+			headers = append(headers, all[i])
+		}
+	}
+	sum.Members = len(headers)
+	if out.json != nil {
+		for _, h := range headers {
+			out.record(newMemberRecord(archivePath, a.Format, &h))
+		}
+		return listErr
+	}
+
+	if len(all) > 0 && all[0].Version != "" {
+		if all[0].Speed != nil {
+			out.printf("Created by version %s at speed %d\n", all[0].Version, *all[0].Speed)
+		} else {
+			out.printf("Created by version %s\n", all[0].Version)
+		}
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Compressed\tUncompressed\tRatio\tModified\tAttr\t  Name")
+	var totalComp, totalDecomp uint64
+	sizesKnown := true // The total is only shown if every member stores its size.
+	for _, h := range headers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t  %s\n", h.CompressedSize, formatSize(h.DecompressedSize), formatRatio(&h), formatTime(h.ModTime), formatAttributes(h.Attributes), h.Filename)
+		totalComp += uint64(h.CompressedSize)
+		totalDecomp += uint64(h.DecompressedSize)
+		if h.DecompressedSize == 0 {
+			sizesKnown = false
+		}
+	}
+	totalSize := "-"
+	if sizesKnown && totalDecomp > 0 {
+		totalSize = fmt.Sprint(totalDecomp)
+	}
+	fmt.Fprintf(tw, "%d\t%s\t\t\t\t  %d file(s)\n", totalComp, totalSize, len(headers))
+	tw.Flush()
+
+	return listErr
+}
+
+func formatSize(size uint32) string {
+	if size == 0 {
+		return "-"
+	}
+	return fmt.Sprint(size)
+}
+
+func formatRatio(h *c.Header) string {
+	r, ok := h.Ratio()
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", r)
+}
+
+func formatAttributes(a c.Attributes) string {
+	if a == 0 {
+		return "-"
+	}
+	return a.String()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
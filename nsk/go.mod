@@ -1,7 +0,0 @@
-module github.com/sourcekris/dclextract/nsk
-
-go 1.21.1
-
-require github.com/sourcekris/dclextract/common v0.0.0-20250615080000-4fe19d6e7fb0
-
-require github.com/JoshVarga/blast v0.0.0-20210808061142-eadad17358e8 // indirect
@@ -2,6 +2,7 @@
 package nsk
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -9,8 +10,50 @@ import (
 	c "github.com/sourcekris/dclextract/common"
 )
 
+func init() {
+	c.Register(c.TypeNSK, format{})
+}
+
+// format implements c.Format for NSK archives.
+type format struct{}
+
+func (format) Name() string      { return "NSK" }
+func (format) Signature() []byte { return c.Signatures[c.TypeNSK] }
+
+func (format) Match(header, footer []byte) bool {
+	return bytes.HasPrefix(header, c.Signatures[c.TypeNSK])
+}
+
+func (format) List(rs io.ReadSeeker) ([]c.Header, error) {
+	return List(rs)
+}
+
+func (format) NewReader(rs io.ReadSeeker) c.MemberReader {
+	return NewReader(rs)
+}
+
+func (format) NewStreamReader(r io.Reader) c.MemberReader {
+	return NewStreamReader(r)
+}
+
+func (format) Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	return Extract(rs)
+}
+
+// Probe checks the signature and the first member of a NSK archive. The
+// member is checked even if the signature is damaged.
+func (format) Probe(rs io.ReadSeeker) c.Candidate {
+	sig := c.Signatures[c.TypeNSK]
+	return c.ProbeArchive(rs, sig, int64(len(sig)), func(rs io.ReadSeeker) (*c.Header, error) {
+		return readMemberFields(rs, 0, 0)
+	})
+}
+
 // readNSKMemberMetadata reads the 14-byte metadata block for an NSK member.
 // Metadata structure: compSize (4), unknown (5), decompSize (4), fnSize (1)
+//
+// The unknown bytes may hold a timestamp, but no description of the format
+// documents one, so NSK members are reported without a modification time.
 func readNSKMemberMetadata(rs io.Reader) (compSize, decompSize uint32, fnSize int, err error) {
 	metadata := make([]byte, 14) // As per unnsk.go structure
 	if _, errRead := io.ReadFull(rs, metadata); errRead != nil {
@@ -24,56 +67,153 @@ func readNSKMemberMetadata(rs io.Reader) (compSize, decompSize uint32, fnSize in
 	return compSize, decompSize, fnSize, nil
 }
 
-func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
-	var allFiles []c.ExtractedFileData
-	processedAnyFile := false
+// formatError returns a *c.FormatError of the given kind for the member'th
+// member of an NSK archive.
+func formatError(member int, offset int64, kind error, format string, args ...any) error {
+	return c.NewFormatError("NSK", member, offset, kind, fmt.Errorf(format, args...))
+}
+
+// readMemberHeader reads the header of the member'th member, leaving rs
+// positioned at the start of its compressed data. It returns io.EOF if the
+// archive ends cleanly before the header.
+func readMemberHeader(rs io.ReadSeeker, member int) (*c.Header, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("NSK: getting member header offset: %w", err)
+	}
+
+	// 1. Read Member Magic (3 bytes "NSK")
+	br, err := c.ReadFileMagic(rs, c.Signatures[c.TypeNSK])
+	if err != nil {
+		// If we read 0 bytes and have processed files, it's a clean end.
+		if br == 0 && member > 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, formatError(member, start, c.ErrBadMagic, "reading member magic: %w", err)
+	}
+
+	return readMemberFields(rs, member, start)
+}
 
+// readMemberFields reads the metadata and filename that follow the magic of
+// the member'th member, whose header starts at start, leaving rs positioned at
+// the start of its compressed data.
+func readMemberFields(rs io.ReadSeeker, member int, start int64) (*c.Header, error) {
+	// 2. Read NSK Member Metadata
+	compSize, decompSize, fnSize, err := readNSKMemberMetadata(rs)
+	if err != nil {
+		return nil, formatError(member, start, c.ErrCorruptHeader, "reading member metadata: %w", err)
+	}
+
+	// 3. Read Filename
+	originalFilename, err := c.ReadFilename(rs, fnSize)
+	if err != nil {
+		return nil, formatError(member, start, c.ErrCorruptHeader, "reading member filename: %w", err)
+	}
+
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("NSK: getting member data offset: %w", err)
+	}
+
+	return &c.Header{
+		Filename:         originalFilename,
+		CompressedSize:   compSize,
+		DecompressedSize: decompSize,
+		Offset:           offset,
+	}, nil
+}
+
+// List reads the member headers of an NSK archive, seeking over the compressed data.
+func List(rs io.ReadSeeker) ([]c.Header, error) {
+	size, err := c.ArchiveSize(rs)
+	if err != nil {
+		return nil, fmt.Errorf("NSK: could not determine archive size: %w", err)
+	}
+
+	var headers []c.Header
 	for {
-		// 1. Read Member Magic (3 bytes "NSK")
-		br, err := c.ReadFileMagic(rs, c.Signatures[c.TypeNSK])
+		h, err := readMemberHeader(rs, len(headers))
+		if err == io.EOF {
+			return headers, nil
+		}
 		if err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				// If we read 0 bytes and have processed files, it's a clean end.
-				if br == 0 && processedAnyFile && err == io.EOF {
-					return allFiles, nil
-				}
-				// Otherwise, it's an unexpected end or an empty file on first try.
-				if processedAnyFile {
-					return allFiles, fmt.Errorf("NSK: unexpected end of archive while expecting next member header: %w", err)
-				}
-				// Error on the very first attempt to read a member (or magic mismatch)
-				return allFiles, fmt.Errorf("NSK: failed to read member header: %w", err)
-			}
-			// Other I/O error
-			return allFiles, fmt.Errorf("NSK: error reading member magic: %w", err)
+			return headers, err
+		}
+		if err := c.SkipData(rs, h.Offset, h.CompressedSize, size); err != nil {
+			return headers, formatError(len(headers), h.Offset, c.ErrTruncated, "member '%s': %w", h.Filename, err)
 		}
+		headers = append(headers, *h)
+	}
+}
 
-		processedAnyFile = true
+// Reader provides sequential access to the members of an NSK archive.
+type Reader struct {
+	rs   io.ReadSeeker
+	n    int   // Number of members read so far.
+	next int64 // Offset of the next member header.
+	err  error // Sticky error.
+}
 
-		// 2. Read NSK Member Metadata
-		compSize, decompSize, fnSize, err := readNSKMemberMetadata(rs)
-		if err != nil {
-			return allFiles, fmt.Errorf("NSK: reading member metadata: %w", err)
+// NewReader returns a Reader that reads members from rs, starting at its
+// current position.
+func NewReader(rs io.ReadSeeker) *Reader {
+	return &Reader{rs: rs}
+}
+
+// NewStreamReader returns a Reader that reads members from r, which need not
+// support seeking. The data of each member is discarded if it is not read.
+func NewStreamReader(r io.Reader) *Reader {
+	return NewReader(c.NewForwardReader(r))
+}
+
+// Next advances to the next member and returns its header and a reader for
+// its decompressed data. It returns io.EOF once there are no more members.
+func (r *Reader) Next() (*c.Header, io.Reader, error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if r.n > 0 {
+		// Skip any unread data of the previous member.
+		if _, err := r.rs.Seek(r.next, io.SeekStart); err != nil {
+			r.err = fmt.Errorf("NSK: seeking to next member: %w", err)
+			return nil, nil, r.err
 		}
+	}
+
+	h, err := readMemberHeader(r.rs, r.n)
+	if err != nil {
+		r.err = err
+		return nil, nil, err
+	}
+	r.n++
+	r.next = h.Offset + int64(h.CompressedSize)
 
-		// 3. Read Filename
-		originalFilename, err := c.ReadFilename(rs, fnSize)
+	return h, c.NewMemberReader(r.rs, "NSK", r.n-1, h), nil
+}
+
+// Extract reads and extracts files from an NSK archive.
+func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	var allFiles []c.ExtractedFileData
+
+	r := NewReader(rs)
+	for {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			return allFiles, nil
+		}
 		if err != nil {
-			return allFiles, fmt.Errorf("NSK: reading member filename for member: %w", err)
+			return allFiles, err
 		}
 
-		// 4. Read Compressed Data & Decompress (using Blast)
-		limitedDataReader := io.LimitReader(rs, int64(compSize))
-		decompressedData, err := c.ReadAndDecompressBlastData(limitedDataReader, compSize, decompSize)
+		decompressedData, err := io.ReadAll(data)
 		if err != nil {
-			return allFiles, fmt.Errorf("NSK: processing data for member '%s': %w", originalFilename, err)
+			return allFiles, fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
 		}
 
 		allFiles = append(allFiles, c.ExtractedFileData{
-			Filename:         originalFilename,
-			Data:             decompressedData,
-			CompressedSize:   compSize,
-			DecompressedSize: decompSize,
+			Header: *h,
+			Data:   decompressedData,
 		})
 	}
 }
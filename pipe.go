@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// pipe writes the decompressed data of every member of the archive at
+// archivePath that matches pattern and sel to w, in archive order. It returns
+// an error if no member matches.
+func pipe(out *reporter, w io.Writer, archivePath, pattern string, sel *selection) (err error) {
+	sum := newSummary(archivePath, "pipe")
+	defer func() { sum.done(out, err) }()
+
+	a, err := openArchive(out, archivePath, true)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	sum.FileType = a.Format.Name()
+	r, err := a.Members(1, sel.selectFunc())
+	if err != nil {
+		return err
+	}
+
+	matched := 0
+	for {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sum.Members++
+		if !matchMember(pattern, h) {
+			continue
+		}
+		matched++
+
+		rec := newMemberRecord(archivePath, a.Format, h)
+		rec.Output = "-"
+		hash := sha256.New()
+		n, err := io.Copy(w, io.TeeReader(data, hash))
+		if err != nil {
+			rec.fail(err)
+			out.record(rec)
+			sum.Failed++
+			return fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
+		}
+		rec.DecompressedSize, rec.SHA256 = n, hex.EncodeToString(hash.Sum(nil))
+		out.record(rec)
+		out.printf("Wrote %s (%d bytes) to standard output\n", h.Filename, n)
+	}
+
+	if matched == 0 {
+		return fmt.Errorf("no member matches %q", pattern)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPipeCLI(t *testing.T) {
+	dir := t.TempDir()
+	spannedArchive(t, dir, zarMember{name: "A.TXT"}, zarMember{name: "B.TXT"})
+	writeFile(t, dir, "ONE.CMZ", cmzArchive(t, "A.TXT", "ONE.TXT"))
+	writeFile(t, dir, "TWO.CMZ", cmzArchive(t, "A.TXT", "TWO.TXT"))
+
+	for _, tc := range []struct {
+		args   []string
+		want   string // Standard output.
+		status int
+	}{
+		{[]string{"-p", "A.TXT", "FOO.ZA1"}, contents("A.TXT"), 0},
+		{[]string{"-p", "b.txt", "FOO.ZA2"}, contents("B.TXT"), 0},
+		{[]string{"-p", "*.TXT", "FOO.ZA1"}, contents("A.TXT") + contents("B.TXT"), 0},
+		// The other volume is dropped and the remaining argument selects members.
+		{[]string{"-p", "*.TXT", "FOO.ZA1", "FOO.ZA2", "B.TXT"}, contents("B.TXT"), 0},
+		{[]string{"-p", "*.TXT", "ONE.CMZ", "T*.TXT"}, "", exitError},
+		{[]string{"-p", "*.TXT", "TWO.CMZ", "T*.TXT"}, contents("TWO.TXT"), 0},
+		{[]string{"-p", "*.TXT", "-index", "2", "ONE.CMZ"}, contents("ONE.TXT"), 0},
+		// Several archives are each searched.
+		{[]string{"-p", "A.TXT", "ONE.CMZ", "TWO.CMZ"}, contents("A.TXT") + contents("A.TXT"), 0},
+		{[]string{"-p", "C.TXT", "FOO.ZA1"}, "", exitError},
+	} {
+		stdout, stderr, status := runCLI(t, dir, tc.args...)
+		if stdout != tc.want || status != tc.status {
+			t.Errorf("dclextract %q wrote %q and exited with %d, want %q and %d; stderr:\n%s", tc.args, stdout, status, tc.want, tc.status, stderr)
+		}
+		if status == 0 && !strings.Contains(stderr, "Detected file type: ") {
+			t.Errorf("dclextract %q did not report the file type on standard error:\n%s", tc.args, stderr)
+		}
+	}
+
+	// Status messages go to standard error.
+	if _, stderr, _ := runCLI(t, dir, "-p", "A.TXT", "FOO.ZA1"); !strings.Contains(stderr, "Detected file type: ZAR (2 volumes)") {
+		t.Errorf("volume set not reported on standard error:\n%s", stderr)
+	}
+}
+
+func TestIdentifyCLI(t *testing.T) {
+	dir := t.TempDir()
+	spannedArchive(t, dir, zarMember{name: "A.TXT"})
+	writeFile(t, dir, "NOTES.TXT", []byte("Some notes about the release, in plain text.\r\n"))
+
+	for _, tc := range []struct {
+		args   []string
+		want   string // Start of the standard output.
+		status int
+	}{
+		{[]string{"-identify", "FOO.ZA1"}, "FOO.ZA2 (2 volumes):\n  ZAR  100%", 0},
+		{[]string{"-identify", "FOO.ZA2", "FOO.ZA1"}, "FOO.ZA2 (2 volumes):\n  ZAR  100%", 0},
+		{[]string{"-identify", "NOTES.TXT"}, "NOTES.TXT:\n", exitBadMagic},
+	} {
+		stdout, stderr, status := runCLI(t, dir, tc.args...)
+		if !strings.HasPrefix(stdout, tc.want) || status != tc.status {
+			t.Errorf("dclextract %q wrote %q and exited with %d, want %q... and %d; stderr:\n%s", tc.args, stdout, status, tc.want, tc.status, stderr)
+		}
+	}
+}
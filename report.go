@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// memberRecord is the JSON record written for each archive member.
+type memberRecord struct {
+	Type             string     `json:"type"` // Always "member".
+	Archive          string     `json:"archive"`
+	FileType         string     `json:"file_type"`
+	Name             string     `json:"name"`
+	CompressedSize   uint32     `json:"compressed_size"`
+	DecompressedSize int64      `json:"decompressed_size,omitempty"` // Stored size, or the actual size once decompressed.
+	Version          string     `json:"version,omitempty"`
+	Speed            *int       `json:"speed,omitempty"` // Only present for formats that store it.
+	ModTime          *time.Time `json:"mod_time,omitempty"`
+	Attributes       string     `json:"attributes,omitempty"`
+	Output           string     `json:"output,omitempty"`
+	SHA256           string     `json:"sha256,omitempty"`
+	Status           string     `json:"status"`           // "ok", "failed" or "skipped".
+	Reason           string     `json:"reason,omitempty"` // Why the member was skipped.
+	Error            string     `json:"error,omitempty"`
+}
+
+// newMemberRecord returns a record describing h in an archive of the given format.
+func newMemberRecord(archivePath string, format c.Format, h *c.Header) *memberRecord {
+	m := &memberRecord{
+		Type:             "member",
+		Archive:          archivePath,
+		FileType:         format.Name(),
+		Name:             h.Filename,
+		CompressedSize:   h.CompressedSize,
+		DecompressedSize: int64(h.DecompressedSize),
+		Version:          h.Version,
+		Speed:            h.Speed,
+		Status:           "ok",
+	}
+	if !h.ModTime.IsZero() {
+		t := h.ModTime
+		m.ModTime = &t
+	}
+	if h.Attributes != 0 {
+		m.Attributes = h.Attributes.String()
+	}
+	return m
+}
+
+// fail marks the record as failed with err.
+func (m *memberRecord) fail(err error) {
+	m.Status = "failed"
+	m.Error = err.Error()
+}
+
+// summaryRecord is the JSON record written after all members of an archive.
+type summaryRecord struct {
+	Type     string `json:"type"` // Always "summary".
+	Archive  string `json:"archive"`
+	FileType string `json:"file_type,omitempty"`
+	Mode     string `json:"mode"` // "list", "test", "extract" or "pipe".
+	Members  int    `json:"members"`
+	Failed   int    `json:"failed"`
+	Skipped  int    `json:"skipped"`
+	Error    string `json:"error,omitempty"`
+}
+
+// batchRecord is the JSON record written after all archives of a batch run.
+type batchRecord struct {
+	Type      string `json:"type"` // Always "batch".
+	Archives  int    `json:"archives"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+}
+
+// identifyRecord is the JSON record written for each file identified.
+type identifyRecord struct {
+	Type       string            `json:"type"` // Always "identify".
+	Archive    string            `json:"archive"`
+	Candidates []candidateRecord `json:"candidates"` // Most likely first.
+}
+
+// candidateRecord is a possible format of an identified file.
+type candidateRecord struct {
+	FileType   string   `json:"file_type"`
+	Confidence int      `json:"confidence"` // From 0 to 100.
+	Evidence   []string `json:"evidence"`
+}
+
+// reporter writes progress either as human-readable text or, in JSON mode,
+// as one JSON record per line. It is safe for concurrent use.
+type reporter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	json *json.Encoder // Nil for text output.
+}
+
+// console is where the CLI reports its progress.
+var console = &reporter{w: os.Stdout}
+
+// setJSON switches the reporter to JSON records.
+func (r *reporter) setJSON() {
+	r.json = json.NewEncoder(r.w)
+}
+
+// buffer returns a reporter in the same mode as r that collects its output in
+// buf, so that the output of archives processed concurrently can be written
+// to r one archive at a time.
+func (r *reporter) buffer(buf *bytes.Buffer) *reporter {
+	b := &reporter{w: buf}
+	if r.json != nil {
+		b.setJSON()
+	}
+	return b
+}
+
+// Write writes text output directly, for use with formatting writers such as
+// text/tabwriter.
+func (r *reporter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.w.Write(p)
+}
+
+// printf prints a line of text output. It prints nothing in JSON mode.
+func (r *reporter) printf(format string, args ...any) {
+	if r.json != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.w, format, args...)
+}
+
+// record writes v as a JSON record. It writes nothing in text mode.
+func (r *reporter) record(v any) {
+	if r.json == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.json.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing JSON output:", err)
+	}
+}
+
+// newSummary returns the summary record for an archive processed in mode.
+func newSummary(archivePath, mode string) *summaryRecord {
+	return &summaryRecord{Type: "summary", Archive: archivePath, Mode: mode}
+}
+
+// done records the error that ended processing, if any, and writes the summary
+// to out.
+func (s *summaryRecord) done(out *reporter, err error) {
+	if err != nil {
+		s.Error = err.Error()
+	}
+	out.record(s)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sourcekris/dclextract/cmz"
+)
+
+// jsonReporter returns a reporter that writes JSON records to buf.
+func jsonReporter(buf *bytes.Buffer) *reporter {
+	out := &reporter{w: buf}
+	out.setJSON()
+	return out
+}
+
+// decodeRecords decodes the JSON records written one per line to buf.
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for {
+		var r map[string]any
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("decoding JSON records: %v", err)
+		}
+		records = append(records, r)
+	}
+}
+
+// checkRecord checks that the fields of got that are named in want have the
+// values in want, after decoding from JSON, and that the fields named in
+// absent are missing.
+func checkRecord(t *testing.T, got map[string]any, want map[string]any, absent ...string) {
+	t.Helper()
+	for k, w := range want {
+		// Round-trip the wanted value so that numbers compare as float64.
+		b, err := json.Marshal(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wv any
+		if err := json.Unmarshal(b, &wv); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got[k], wv) {
+			t.Errorf("%s record field %q = %v, want %v", got["type"], k, got[k], wv)
+		}
+	}
+	for _, k := range absent {
+		if v, ok := got[k]; ok {
+			t.Errorf("%s record has field %q = %v, want none", got["type"], k, v)
+		}
+	}
+}
+
+// hashOf returns the hex-encoded SHA-256 hash of the contents of the member
+// called name.
+func hashOf(name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(contents(name))))
+}
+
+func TestJSONRecords(t *testing.T) {
+	dir := t.TempDir()
+	cmzPath := writeFile(t, dir, "DATA.CMZ", cmzArchive(t, "A.TXT"))
+	zarPath := writeFile(t, dir, "DATA.ZAR", zarArchive(t, 0x0003, zarMember{name: "B.TXT", attr: 0x9}))
+	outDir := filepath.Join(dir, "out")
+	stamp := memberTime.Format(time.RFC3339)
+	cmzMember := map[string]any{
+		"type":              "member",
+		"archive":           cmzPath,
+		"file_type":         "CMZ",
+		"name":              "A.TXT",
+		"decompressed_size": len(contents("A.TXT")),
+		"mod_time":          stamp,
+		"status":            "ok",
+	}
+
+	for _, tc := range []struct {
+		mode   string
+		path   string
+		run    func(out *reporter, path string) error
+		member map[string]any // Fields of the member record other than those in cmzMember.
+		absent []string       // Fields the member record must not have.
+	}{
+		{
+			mode:   "list",
+			path:   cmzPath,
+			run:    func(out *reporter, path string) error { return list(out, path, nil) },
+			absent: []string{"output", "sha256", "error", "version", "speed", "attributes"},
+		},
+		{
+			mode: "test",
+			path: cmzPath,
+			run: func(out *reporter, path string) error {
+				_, err := test(out, path, nil)
+				return err
+			},
+			member: map[string]any{"sha256": hashOf("A.TXT")},
+			absent: []string{"output", "error"},
+		},
+		{
+			mode: "extract",
+			path: cmzPath,
+			run: func(out *reporter, path string) error {
+				_, err := (&extractor{outputDir: outDir}).extract(out, path)
+				return err
+			},
+			member: map[string]any{"sha256": hashOf("A.TXT"), "output": filepath.Join(outDir, "A.TXT")},
+			absent: []string{"error"},
+		},
+		{
+			mode: "list",
+			path: zarPath,
+			run:  func(out *reporter, path string) error { return list(out, path, nil) },
+			member: map[string]any{
+				"archive":    zarPath,
+				"file_type":  "ZAR",
+				"name":       "B.TXT",
+				"version":    "2.6",
+				"speed":      3,
+				"attributes": "R--A",
+			},
+			absent: []string{"decompressed_size", "mod_time", "output", "sha256", "error"},
+		},
+	} {
+		t.Run(tc.mode+" "+filepath.Base(tc.path), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.run(jsonReporter(&buf), tc.path); err != nil {
+				t.Fatalf("%s: %v", tc.mode, err)
+			}
+			records := decodeRecords(t, &buf)
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want a member and a summary: %v", len(records), records)
+			}
+
+			want := map[string]any{}
+			for k, v := range cmzMember {
+				want[k] = v
+			}
+			for k, v := range tc.member {
+				want[k] = v
+			}
+			for _, k := range tc.absent {
+				delete(want, k)
+			}
+			checkRecord(t, records[0], want, tc.absent...)
+			if size, ok := records[0]["compressed_size"].(float64); !ok || size <= 0 {
+				t.Errorf("compressed_size = %v, want a positive size", records[0]["compressed_size"])
+			}
+
+			checkRecord(t, records[1], map[string]any{
+				"type":      "summary",
+				"archive":   tc.path,
+				"file_type": want["file_type"],
+				"mode":      tc.mode,
+				"members":   1,
+				"failed":    0,
+				"skipped":   0,
+			}, "error")
+		})
+	}
+}
+
+func TestJSONRecordsFailure(t *testing.T) {
+	// The member's data does not decompress.
+	b := cmzArchive(t, "A.TXT", "B.TXT")
+	headers, err := cmz.List(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	b[headers[1].Offset] = 7 // Not a valid DCL literal mode.
+	path := writeFile(t, t.TempDir(), "BAD.CMZ", b)
+
+	var buf bytes.Buffer
+	failures, err := test(jsonReporter(&buf), path, nil)
+	if err != nil || len(failures) != 1 {
+		t.Fatalf("test = %v, %v; want one failure", failures, err)
+	}
+	records := decodeRecords(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want two members and a summary: %v", len(records), records)
+	}
+	checkRecord(t, records[0], map[string]any{"name": "A.TXT", "status": "ok"}, "error")
+	checkRecord(t, records[1], map[string]any{"name": "B.TXT", "status": "failed", "error": failures[0].Error()}, "sha256")
+	checkRecord(t, records[2], map[string]any{"type": "summary", "mode": "test", "members": 2, "failed": 1})
+
+	// An archive that cannot be opened is reported in the summary alone.
+	buf.Reset()
+	err = list(jsonReporter(&buf), filepath.Join(t.TempDir(), "MISSING.CMZ"), nil)
+	if err == nil {
+		t.Fatal("list of a missing archive succeeded")
+	}
+	records = decodeRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want a summary: %v", len(records), records)
+	}
+	checkRecord(t, records[0], map[string]any{"type": "summary", "mode": "list", "error": err.Error()}, "file_type")
+}
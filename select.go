@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// selection chooses the members of an archive to process. A member is
+// selected if it matches one of the patterns or has the given index, or if
+// neither is given, and it matches none of the excludes. A nil selection
+// selects every member.
+type selection struct {
+	patterns []string // Glob patterns of members to include.
+	excludes []string // Glob patterns of members to leave out.
+	index    int      // Index of a member to include, counting from one, or 0.
+}
+
+// keep reports whether the i'th member, counting from zero, is selected. It
+// is a c.SelectFunc.
+func (s *selection) keep(i int, h *c.Header) bool {
+	if s == nil {
+		return true
+	}
+	included := len(s.patterns) == 0 && s.index == 0
+	if s.index == i+1 {
+		included = true
+	}
+	for _, p := range s.patterns {
+		if matchMember(p, h) {
+			included = true
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, p := range s.excludes {
+		if matchMember(p, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectFunc returns s.keep, or nil if s selects every member.
+func (s *selection) selectFunc() c.SelectFunc {
+	if s == nil || (len(s.patterns) == 0 && len(s.excludes) == 0 && s.index == 0) {
+		return nil
+	}
+	return s.keep
+}
+
+// patternList is a flag.Value that collects the patterns of a repeated flag.
+type patternList []string
+
+func (l *patternList) String() string { return strings.Join(*l, ",") }
+
+func (l *patternList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// matchMember reports whether the glob pattern matches the name of the member
+// h. Names are compared without regard to case, as on DOS, using both the
+// name stored in the archive, as shown by -l, and the path the member would be
+// extracted to. Backslashes in either are treated as slashes. A pattern
+// without a slash also matches the last element of the path, so "*.TXT"
+// selects text files in any directory.
+func matchMember(pattern string, h *c.Header) bool {
+	pattern = normalizeName(pattern)
+	for _, name := range []string{normalizeName(h.Filename), normalizeName(c.SanitizePath(h.Filename))} {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeName returns name in lower case with slashes as separators.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, `\`, "/"))
+}
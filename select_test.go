@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sourcekris/dclextract/archive"
+	"github.com/sourcekris/dclextract/cmz"
+	c "github.com/sourcekris/dclextract/common"
+)
+
+func TestMatchMember(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"README.TXT", "README.TXT", true},
+		{"readme.txt", "README.TXT", true},
+		{"ReadMe.Txt", "readme.txt", true},
+		{"*.TXT", "NOTES.txt", true},
+		{"*.TXT", "NOTES.DOC", false},
+		{"????????.???", "AUTOEXEC.BAT", true},
+		{"????????.???", "WIN.COM", false},
+		{"WIN.*", "WIN.COM", true},
+		{"WIN.*", "WINDOWS.HLP", false},
+		{"WIN*", "WINDOWS.HLP", true},
+		{"[AB]*.DRV", "VGA.DRV", false},
+		{"[uv]*.drv", "VGA.DRV", true},
+		// A pattern without a slash also matches the file name alone.
+		{"README.TXT", `C:\DOS\README.TXT`, true},
+		{"*.SYS", `C:\WINDOWS\SYSTEM\HIMEM.SYS`, true},
+		// Paths match with either separator, as stored or as extracted.
+		{`DOS\README.TXT`, `C:\DOS\README.TXT`, true},
+		{"dos/*.txt", `C:\DOS\README.TXT`, true},
+		{`C:\DOS\*`, `C:\DOS\README.TXT`, true},
+		{"WINDOWS/*.TXT", `C:\DOS\README.TXT`, false},
+	} {
+		if got := matchMember(tc.pattern, &c.Header{Filename: tc.name}); got != tc.want {
+			t.Errorf("matchMember(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSelectionKeep(t *testing.T) {
+	names := []string{"README.TXT", "SETUP.EXE", "SETUP.INI", `DOCS\MANUAL.TXT`}
+	for _, tc := range []struct {
+		name string
+		sel  *selection
+		want []string
+	}{
+		{"nil", nil, names},
+		{"empty", &selection{}, names},
+		{"pattern", &selection{patterns: []string{"setup.*"}}, []string{"SETUP.EXE", "SETUP.INI"}},
+		{"patterns", &selection{patterns: []string{"*.EXE", "*.TXT"}}, []string{"README.TXT", "SETUP.EXE", `DOCS\MANUAL.TXT`}},
+		{"exclude", &selection{excludes: []string{"*.TXT"}}, []string{"SETUP.EXE", "SETUP.INI"}},
+		{"exclude wins over include", &selection{patterns: []string{"SETUP.*"}, excludes: []string{"*.INI"}}, []string{"SETUP.EXE"}},
+		{"exclude wins over index", &selection{index: 2, excludes: []string{"*.EXE"}}, nil},
+		{"first index", &selection{index: 1}, []string{"README.TXT"}},
+		{"last index", &selection{index: 4}, []string{`DOCS\MANUAL.TXT`}},
+		{"index past the end", &selection{index: 5}, nil},
+		{"negative index", &selection{index: -1}, nil},
+		{"index or pattern", &selection{index: 1, patterns: []string{"*.INI"}}, []string{"README.TXT", "SETUP.INI"}},
+		{"nothing matches", &selection{patterns: []string{"*.BAT"}}, nil},
+	} {
+		var got []string
+		for i, name := range names {
+			if tc.sel.keep(i, &c.Header{Filename: name}) {
+				got = append(got, name)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: selected %q, want %q", tc.name, got, tc.want)
+		}
+		// Only a selection of every member needs no SelectFunc.
+		all := tc.sel == nil || reflect.DeepEqual(tc.sel, &selection{})
+		if f := tc.sel.selectFunc(); (f == nil) != all {
+			t.Errorf("%s: selectFunc() is nil: %v, want %v", tc.name, f == nil, all)
+		}
+	}
+}
+
+func TestPatternList(t *testing.T) {
+	var l patternList
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&l, "exclude", "")
+	if err := fs.Parse([]string{"-exclude", "*.BAK", "-exclude", `DOS\*`}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := []string{"*.BAK", `DOS\*`}; !reflect.DeepEqual([]string(l), want) {
+		t.Errorf("patterns = %q, want %q", l, want)
+	}
+	if got, want := l.String(), `*.BAK,DOS\*`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+// damagedArchive returns a CMZ archive with members A.TXT, BAD.TXT and C.TXT,
+// where the data of BAD.TXT does not decompress.
+func damagedArchive(t *testing.T) []byte {
+	t.Helper()
+	b := cmzArchive(t, "A.TXT", "BAD.TXT", "C.TXT")
+	headers, err := cmz.List(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	b[headers[1].Offset] = 7 // Not a valid DCL literal mode.
+	return b
+}
+
+func TestExcludedMembersNotDecoded(t *testing.T) {
+	// Decompressing BAD.TXT fails, so excluding it must skip its data.
+	dir := t.TempDir()
+	path := writeFile(t, dir, "DAMAGED.CMZ", damagedArchive(t))
+	for _, sel := range []*selection{
+		{excludes: []string{"bad.txt"}},
+		{patterns: []string{"?.TXT"}},
+		{index: 3},
+	} {
+		var buf bytes.Buffer
+		out := &reporter{w: &buf}
+		x := &extractor{outputDir: filepath.Join(dir, "out"), sel: sel}
+		if _, err := x.extract(out, path); err != nil {
+			t.Errorf("extract with %+v: %v", sel, err)
+		}
+		if failures, err := test(out, path, sel); err != nil || len(failures) > 0 {
+			t.Errorf("test with %+v = %v, %v; want no failures", sel, failures, err)
+		}
+	}
+
+	// Without the selection the damage is found.
+	if failures, _ := test(&reporter{w: io.Discard}, path, nil); len(failures) != 1 {
+		t.Errorf("test found %d failures, want 1", len(failures))
+	}
+
+	// Streamed archives skip the data unread too.
+	a, err := archive.OpenStream(bytes.NewReader(damagedArchive(t)))
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	sel := &selection{excludes: []string{"BAD.TXT"}}
+	r, err := a.Members(1, sel.selectFunc())
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	var got []string
+	for {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		b, err := io.ReadAll(data)
+		if err != nil {
+			t.Fatalf("reading %s: %v", h.Filename, err)
+		}
+		got = append(got, string(b))
+	}
+	if want := []string{contents("A.TXT"), contents("C.TXT")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed members = %q, want %q", got, want)
+	}
+}
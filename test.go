@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// test decompresses every member of the archive at archivePath that sel
+// selects without writing anything and reports the status of each. It returns
+// the errors of the members that failed, and an error if the archive itself
+// could not be read.
+func test(out *reporter, archivePath string, sel *selection) (failures []error, err error) {
+	sum := newSummary(archivePath, "test")
+	defer func() { sum.done(out, err) }()
+
+	a, err := openArchive(out, archivePath, false)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	sum.FileType = a.Format.Name()
+
+	headers, listErr := a.List()
+	for i, h := range headers {
+		if !sel.keep(i, &h) {
+			continue
+		}
+		sum.Members++
+		rec := newMemberRecord(archivePath, a.Format, &h)
+		data, err := a.OpenMember(i, &h)
+		if err != nil {
+			return failures, err
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, data)
+		data.Close()
+		if err != nil {
+			out.printf("Testing %s ... FAILED: %v\n", h.Filename, err)
+			failures = append(failures, err)
+			rec.fail(err)
+			out.record(rec)
+			continue
+		}
+		out.printf("Testing %s ... OK (%d bytes)\n", h.Filename, n)
+		rec.DecompressedSize = n
+		rec.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		out.record(rec)
+	}
+
+	// A member whose header could not be read is reported as failed too if it
+	// is selected. Its name is unknown, so only its position can select it.
+	var fe *c.FormatError
+	if errors.As(listErr, &fe) && fe.Member >= 0 && sel.keep(fe.Member, &c.Header{}) {
+		sum.Members++
+		out.printf("Testing member %d ... FAILED: %v\n", fe.Member+1, listErr)
+		failures = append(failures, listErr)
+		rec := newMemberRecord(archivePath, a.Format, &c.Header{})
+		rec.fail(listErr)
+		out.record(rec)
+	}
+	sum.Failed = len(failures)
+
+	if listErr != nil {
+		return failures, listErr
+	}
+	if len(failures) > 0 {
+		out.printf("%d of %d member(s) failed.\n", len(failures), sum.Members)
+	} else {
+		out.printf("No errors detected in %d member(s).\n", sum.Members)
+	}
+	return failures, nil
+}
@@ -1,7 +0,0 @@
-module github.com/sourcekris/dclextract/tsc
-
-go 1.21.1
-
-require github.com/sourcekris/dclextract/common v0.0.0-20250622033919-313e2710de76
-
-require github.com/JoshVarga/blast v0.0.0-20210808061142-eadad17358e8 // indirect
@@ -2,6 +2,7 @@
 package tsc
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -9,6 +10,48 @@ import (
 	c "github.com/sourcekris/dclextract/common"
 )
 
+func init() {
+	c.Register(c.TypeTSC, format{})
+}
+
+// format implements c.Format for TSC archives.
+type format struct{}
+
+func (format) Name() string      { return "TSC" }
+func (format) Signature() []byte { return c.Signatures[c.TypeTSC] }
+
+func (format) Match(header, footer []byte) bool {
+	return bytes.HasPrefix(header, c.Signatures[c.TypeTSC])
+}
+
+func (format) List(rs io.ReadSeeker) ([]c.Header, error) {
+	return List(rs)
+}
+
+func (format) NewReader(rs io.ReadSeeker) c.MemberReader {
+	return NewReader(rs)
+}
+
+func (format) NewStreamReader(r io.Reader) c.MemberReader {
+	return NewStreamReader(r)
+}
+
+func (format) Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	return Extract(rs)
+}
+
+// archiveHeaderLen is the length of the file-level header: the signature,
+// version (3), wildcard value (1) and reserved bytes (4).
+var archiveHeaderLen = int64(len(c.Signatures[c.TypeTSC]) + 8)
+
+// Probe checks the signature and the first member of a TSC archive. The
+// member is checked even if the signature is damaged.
+func (format) Probe(rs io.ReadSeeker) c.Candidate {
+	return c.ProbeArchive(rs, c.Signatures[c.TypeTSC], archiveHeaderLen, func(rs io.ReadSeeker) (*c.Header, error) {
+		return readMemberHeader(rs, 0, "")
+	})
+}
+
 // readTSCMemberHeader reads the 16-byte header for a single member inside a TSC archive.
 func readTSCMemberHeader(rs io.Reader) (compSize uint32, fnSize int, err error) {
 	header := make([]byte, 16)
@@ -21,22 +64,31 @@ func readTSCMemberHeader(rs io.Reader) (compSize uint32, fnSize int, err error)
 	}
 
 	// The structure of the member header is inferred from previous implementations.
+	// Nothing is known about the other bytes, so TSC members are reported
+	// without a modification time.
 	compSize = binary.LittleEndian.Uint32(header[1:5])
 	fnSize = int(header[15])
 	return compSize, fnSize, nil
 }
 
-// Extract processes a TSC archive and extracts all contained files.
-func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+// formatError returns a *c.FormatError of the given kind for the member'th
+// member of a TSC archive, or for the archive header if member is -1.
+func formatError(member int, offset int64, kind error, format string, args ...any) error {
+	return c.NewFormatError("TSC", member, offset, kind, fmt.Errorf(format, args...))
+}
+
+// readArchiveHeader reads the file-level header of a TSC archive and returns
+// the archive version, leaving rs positioned at the first member header.
+func readArchiveHeader(rs io.ReadSeeker) (string, error) {
 	// 1. Read file-level magic bytes (once)
 	if _, err := c.ReadFileMagic(rs, c.Signatures[c.TypeTSC]); err != nil {
-		return nil, fmt.Errorf("TSC: reading file magic: %w", err)
+		return "", formatError(-1, 0, c.ErrBadMagic, "reading file magic: %w", err)
 	}
 
 	// 2. Read file-level version information (once)
 	versionBytes := make([]byte, 3)
 	if _, err := io.ReadFull(rs, versionBytes); err != nil {
-		return nil, fmt.Errorf("TSC: reading version info: %w", err)
+		return "", formatError(-1, -1, c.ErrCorruptHeader, "reading version info: %w", err)
 	}
 	majorVersion := versionBytes[0]
 	minorVersion := binary.LittleEndian.Uint16(versionBytes[1:3])
@@ -45,46 +97,158 @@ func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
 	// 3. Read the wildcard value (1 byte)
 	var wildcardValue [1]byte
 	if _, err := io.ReadFull(rs, wildcardValue[:]); err != nil {
-		return nil, fmt.Errorf("TSC: reading wildcard value: %w", err)
+		return "", formatError(-1, -1, c.ErrCorruptHeader, "reading wildcard value: %w", err)
 	}
 
 	// 4. Seek past the reserved bytes (4 bytes)
 	if _, err := rs.Seek(4, io.SeekCurrent); err != nil {
-		return nil, fmt.Errorf("TSC: seeking past reserved bytes: %w", err)
+		return "", fmt.Errorf("TSC: seeking past reserved bytes: %w", err)
 	}
+	return versionStr, nil
+}
 
-	var allFiles []c.ExtractedFileData
+// readMemberHeader reads the header and filename of the member'th member,
+// leaving rs positioned at the start of its compressed data. It returns io.EOF
+// once all members have been read.
+func readMemberHeader(rs io.ReadSeeker, member int, version string) (*c.Header, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("TSC: getting member header offset: %w", err)
+	}
+
+	// 5. Read the header for the next member
+	compSize, fnSize, err := readTSCMemberHeader(rs)
+	if err != nil {
+		if err == io.EOF {
+			// Cleanly reached the end of all members
+			return nil, io.EOF
+		}
+		return nil, formatError(member, start, c.ErrCorruptHeader, "reading member header: %w", err)
+	}
+
+	// 6. Read Filename
+	originalFilename, err := c.ReadFilename(rs, fnSize+1) // +1 for the null terminator.
+	if err != nil {
+		return nil, formatError(member, start, c.ErrCorruptHeader, "reading member filename: %w", err)
+	}
+
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("TSC: getting member data offset: %w", err)
+	}
 
+	return &c.Header{
+		Filename:       originalFilename,
+		CompressedSize: compSize,
+		Version:        version, // Apply global version to this file
+		Offset:         offset,
+	}, nil
+}
+
+// List reads the member headers of a TSC archive, seeking over the compressed
+// data. TSC does not store decompressed sizes, so they are reported as zero.
+func List(rs io.ReadSeeker) ([]c.Header, error) {
+	size, err := c.ArchiveSize(rs)
+	if err != nil {
+		return nil, fmt.Errorf("TSC: could not determine archive size: %w", err)
+	}
+
+	version, err := readArchiveHeader(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []c.Header
 	for {
-		// 5. Read the header for the next member
-		compSize, fnSize, err := readTSCMemberHeader(rs)
+		h, err := readMemberHeader(rs, len(headers), version)
+		if err == io.EOF {
+			return headers, nil
+		}
 		if err != nil {
-			if err == io.EOF {
-				// Cleanly reached the end of all members
-				break
-			}
-			return allFiles, fmt.Errorf("TSC: reading member header: %w", err)
+			return headers, err
+		}
+		if err := c.SkipData(rs, h.Offset, h.CompressedSize, size); err != nil {
+			return headers, formatError(len(headers), h.Offset, c.ErrTruncated, "member '%s': %w", h.Filename, err)
+		}
+		headers = append(headers, *h)
+	}
+}
+
+// Reader provides sequential access to the members of a TSC archive.
+type Reader struct {
+	rs      io.ReadSeeker
+	version string // Archive version, read before the first member.
+	started bool   // The archive header has been read.
+	n       int    // Number of members read so far.
+	next    int64  // Offset of the next member header.
+	err     error  // Sticky error.
+}
+
+// NewReader returns a Reader that reads members from rs, starting at its
+// current position.
+func NewReader(rs io.ReadSeeker) *Reader {
+	return &Reader{rs: rs}
+}
+
+// NewStreamReader returns a Reader that reads members from r, which need not
+// support seeking. The data of each member is discarded if it is not read.
+func NewStreamReader(r io.Reader) *Reader {
+	return NewReader(c.NewForwardReader(r))
+}
+
+// Next advances to the next member and returns its header and a reader for
+// its decompressed data. It returns io.EOF once there are no more members.
+func (r *Reader) Next() (*c.Header, io.Reader, error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if !r.started {
+		r.version, r.err = readArchiveHeader(r.rs)
+		if r.err != nil {
+			return nil, nil, r.err
 		}
+		r.started = true
+	} else if _, err := r.rs.Seek(r.next, io.SeekStart); err != nil {
+		// Skip any unread data of the previous member.
+		r.err = fmt.Errorf("TSC: seeking to next member: %w", err)
+		return nil, nil, r.err
+	}
+
+	h, err := readMemberHeader(r.rs, r.n, r.version)
+	if err != nil {
+		r.err = err
+		return nil, nil, err
+	}
+	r.n++
+	r.next = h.Offset + int64(h.CompressedSize)
 
-		// 6. Read Filename
-		originalFilename, err := c.ReadFilename(rs, fnSize+1) // +1 for the null terminator.
+	// TSC does not provide decompressed size in the member.
+	return h, c.NewMemberReader(r.rs, "TSC", r.n-1, h), nil
+}
+
+// Extract processes a TSC archive and extracts all contained files.
+func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	var allFiles []c.ExtractedFileData
+
+	r := NewReader(rs)
+	for {
+		h, data, err := r.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return allFiles, fmt.Errorf("TSC: reading member filename for member: %w", err)
+			return allFiles, err
 		}
 
-		// 7. Read Compressed Data & Decompress (using Blast)
-		limitedDataReader := io.LimitReader(rs, int64(compSize))
-		decompressedData, err := c.ReadAndDecompressBlastData(limitedDataReader, compSize, 0) // TSC does not provide decompressed size in the member.
+		decompressedData, err := io.ReadAll(data)
 		if err != nil {
-			return allFiles, fmt.Errorf("TSC: processing data for member '%s': %w", originalFilename, err)
+			return allFiles, fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
 		}
 
+		h.DecompressedSize = uint32(len(decompressedData)) // Set size after decompression
 		allFiles = append(allFiles, c.ExtractedFileData{
-			Filename:         originalFilename,
-			Data:             decompressedData,
-			CompressedSize:   compSize,
-			DecompressedSize: uint32(len(decompressedData)), // Set size after decompression
-			Version:          versionStr,                    // Apply global version to this file
+			Header: *h,
+			Data:   decompressedData,
 		})
 	}
 	return allFiles, nil
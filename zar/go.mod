@@ -1,7 +0,0 @@
-module github.com/sourcekris/dclextract/zar
-
-go 1.21.1
-
-require github.com/sourcekris/dclextract/common v0.0.0-20250622042238-cf6deb8ed1a2
-
-require github.com/JoshVarga/blast v0.0.0-20210808061142-eadad17358e8 // indirect
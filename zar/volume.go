@@ -0,0 +1,176 @@
+package zar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Volumes is a multi-volume ZAR archive opened as a single stream. ZIP.EXE
+// splits the archive data across the volumes as they are written, and only
+// the last volume holds the table of contents and the info block, so the
+// concatenation of all volumes reads like a single archive.
+type Volumes struct {
+	files []*os.File
+	ends  []int64 // Offset just past the end of each volume in the stream.
+	pos   int64
+}
+
+// OpenVolumes opens the files at paths, in order, as one multi-volume archive.
+func OpenVolumes(paths []string) (*Volumes, error) {
+	v := &Volumes{}
+	var end int64
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			v.Close()
+			return nil, err
+		}
+		v.files = append(v.files, f)
+
+		fi, err := f.Stat()
+		if err != nil {
+			v.Close()
+			return nil, err
+		}
+		end += fi.Size()
+		v.ends = append(v.ends, end)
+	}
+	return v, nil
+}
+
+// Size returns the combined size of all volumes.
+func (v *Volumes) Size() int64 {
+	if len(v.ends) == 0 {
+		return 0
+	}
+	return v.ends[len(v.ends)-1]
+}
+
+// ReadAt implements io.ReaderAt, reading across volume boundaries as needed.
+func (v *Volumes) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("zar: negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		i := sort.Search(len(v.ends), func(i int) bool { return v.ends[i] > off })
+		if i == len(v.ends) {
+			return n, io.EOF
+		}
+		start := v.ends[i] - v.fileSize(i)
+		want := p[n:]
+		if rest := v.ends[i] - off; int64(len(want)) > rest {
+			want = want[:rest]
+		}
+		m, err := v.files[i].ReadAt(want, off-start)
+		n += m
+		off += int64(m)
+		if err != nil && !(err == io.EOF && m == len(want)) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// fileSize returns the size of volume i.
+func (v *Volumes) fileSize(i int) int64 {
+	if i == 0 {
+		return v.ends[0]
+	}
+	return v.ends[i] - v.ends[i-1]
+}
+
+// Read implements io.Reader.
+func (v *Volumes) Read(p []byte) (int, error) {
+	if v.pos >= v.Size() {
+		return 0, io.EOF
+	}
+	n, err := v.ReadAt(p, v.pos)
+	v.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (v *Volumes) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += v.pos
+	case io.SeekEnd:
+		offset += v.Size()
+	default:
+		return 0, errors.New("zar: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("zar: negative position")
+	}
+	v.pos = offset
+	return offset, nil
+}
+
+// Close closes every volume.
+func (v *Volumes) Close() error {
+	var err error
+	for _, f := range v.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// VolumePaths returns the paths of every volume in the set that path belongs
+// to, in order. Volumes share a name and differ only in a number at the end of
+// the extension, such as FOO.ZA1, FOO.ZA2 and so on; names are compared
+// without regard to case, as on DOS. If path has no numbered siblings, only
+// path is returned.
+func VolumePaths(path string) ([]string, error) {
+	dir, name := filepath.Split(path)
+	prefix := strings.TrimRight(name, "0123456789")
+	if prefix == name || !strings.Contains(prefix, ".") {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil, err
+	}
+	volumes := map[int]string{}
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || len(strings.TrimRight(n, "0123456789")) != len(prefix) || !strings.EqualFold(n[:len(prefix)], prefix) {
+			continue
+		}
+		num, err := strconv.Atoi(n[len(prefix):])
+		if err != nil {
+			continue
+		}
+		volumes[num] = filepath.Join(dir, n)
+	}
+	if len(volumes) < 2 {
+		return []string{path}, nil
+	}
+
+	nums := make([]int, 0, len(volumes))
+	for num := range volumes {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	paths := make([]string, 0, len(nums))
+	for i, num := range nums {
+		if i > 0 && num != nums[i-1]+1 {
+			return nil, fmt.Errorf("ZAR: volume %d of %s%d-%d is missing", nums[i-1]+1, prefix, nums[0], nums[len(nums)-1])
+		}
+		paths = append(paths, volumes[num])
+	}
+	return paths, nil
+}
@@ -0,0 +1,165 @@
+package zar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// splitVolumes writes data to numbered volumes FOO.ZA1, FOO.ZA2 and so on in
+// a new directory, with the given sizes, and returns their paths.
+func splitVolumes(t *testing.T, data []byte, sizes ...int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i, size := range sizes {
+		path := filepath.Join(dir, "FOO.ZA"+string(rune('1'+i)))
+		if err := os.WriteFile(path, data[:size], 0644); err != nil {
+			t.Fatal(err)
+		}
+		data = data[size:]
+		paths = append(paths, path)
+	}
+	if len(data) != 0 {
+		t.Fatalf("splitVolumes: %d bytes left over", len(data))
+	}
+	return paths
+}
+
+func TestVolumesReadAt(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	for _, tc := range []struct {
+		name    string
+		sizes   []int
+		off     int64
+		n       int
+		want    string
+		wantErr error
+	}{
+		{name: "within a volume", sizes: []int{8, 12}, off: 2, n: 4, want: "2345"},
+		{name: "across a boundary", sizes: []int{8, 12}, off: 6, n: 4, want: "6789"},
+		{name: "across every volume", sizes: []int{5, 5, 10}, off: 0, n: 20, want: "0123456789abcdefghij"},
+		{name: "starting at a boundary", sizes: []int{8, 12}, off: 8, n: 3, want: "89a"},
+		{name: "over empty volumes", sizes: []int{0, 6, 0, 0, 14}, off: 4, n: 4, want: "4567"},
+		{name: "past the end", sizes: []int{8, 12}, off: 18, n: 4, want: "ij", wantErr: io.EOF},
+		{name: "at the end", sizes: []int{8, 12}, off: 20, n: 1, want: "", wantErr: io.EOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := OpenVolumes(splitVolumes(t, data, tc.sizes...))
+			if err != nil {
+				t.Fatalf("OpenVolumes: %v", err)
+			}
+			defer v.Close()
+			if v.Size() != int64(len(data)) {
+				t.Errorf("Size = %d, want %d", v.Size(), len(data))
+			}
+
+			p := make([]byte, tc.n)
+			n, err := v.ReadAt(p, tc.off)
+			if err != tc.wantErr {
+				t.Errorf("ReadAt error = %v, want %v", err, tc.wantErr)
+			}
+			if got := string(p[:n]); got != tc.want {
+				t.Errorf("ReadAt = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVolumesList(t *testing.T) {
+	data := archive(60, concat(
+		entry(0, "WIN.COM", 10),
+		entry(0, "WINDOWS.HLP", 20),
+		entry(0, "BEWERBUN.WRI", 30),
+	), 0x0080, 0x26)
+	want, err := List(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	// The table of contents starts in the second volume and ends in the last.
+	v, err := OpenVolumes(splitVolumes(t, data, 25, 0, 45, len(data)-70))
+	if err != nil {
+		t.Fatalf("OpenVolumes: %v", err)
+	}
+	defer v.Close()
+	info, err := ReadInfo(v)
+	if err != nil {
+		t.Fatalf("ReadInfo: %v", err)
+	}
+	if !info.Config.MultiVolume() {
+		t.Errorf("MultiVolume() = false, want true")
+	}
+	got, err := List(v)
+	if err != nil {
+		t.Fatalf("List of volumes: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List of volumes = %+v, want %+v", got, want)
+	}
+}
+
+func TestVolumePaths(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		files   []string
+		path    string
+		want    []string // Nil if only path is expected.
+		wantErr bool
+	}{
+		{name: "set", files: []string{"FOO.ZA1", "FOO.ZA2", "FOO.ZA3"}, path: "FOO.ZA3", want: []string{"FOO.ZA1", "FOO.ZA2", "FOO.ZA3"}},
+		{name: "from the first volume", files: []string{"FOO.ZA1", "FOO.ZA2"}, path: "FOO.ZA1", want: []string{"FOO.ZA1", "FOO.ZA2"}},
+		{name: "numeric order", files: []string{"FOO.Z9", "FOO.Z10", "FOO.Z8"}, path: "FOO.Z10", want: []string{"FOO.Z8", "FOO.Z9", "FOO.Z10"}},
+		{name: "case insensitive", files: []string{"foo.za1", "FOO.ZA2", "Foo.Za3"}, path: "FOO.ZA2", want: []string{"foo.za1", "FOO.ZA2", "Foo.Za3"}},
+		{name: "other sets ignored", files: []string{"FOO.ZA1", "FOO.ZA2", "BAR.ZA1", "FOO.ZB3", "FOO.ZA2.BAK"}, path: "FOO.ZA2", want: []string{"FOO.ZA1", "FOO.ZA2"}},
+		{name: "no siblings", files: []string{"FOO.ZA1", "BAR.ZA2"}, path: "FOO.ZA1"},
+		{name: "no number", files: []string{"FOO.ZAR", "FOO.ZA1"}, path: "FOO.ZAR"},
+		{name: "number without extension", files: []string{"FOO1", "FOO2"}, path: "FOO2"},
+		{name: "missing volume", files: []string{"FOO.ZA1", "FOO.ZA2", "FOO.ZA4"}, path: "FOO.ZA4", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tc.files {
+				if err := os.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Mkdir(filepath.Join(dir, "FOO.ZA9"), 0755); err != nil {
+				t.Fatal(err) // Directories are never volumes.
+			}
+
+			got, err := VolumePaths(filepath.Join(dir, tc.path))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("VolumePaths = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VolumePaths: %v", err)
+			}
+			want := []string{filepath.Join(dir, tc.path)}
+			if tc.want != nil {
+				want = nil
+				for _, f := range tc.want {
+					want = append(want, filepath.Join(dir, f))
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("VolumePaths = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestOpenVolumesMissingFile(t *testing.T) {
+	paths := splitVolumes(t, make([]byte, 10), 5, 5)
+	_, err := OpenVolumes(append(paths, paths[0]+"X"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenVolumes error = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -2,206 +2,320 @@
 package zar
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
 
 	c "github.com/sourcekris/dclextract/common"
 )
 
-const (
-	// zarFooterLen is the length of the ZAR file footer, which consists of
-	// 4 unknown bytes and a 3-byte magic signature ("PT&").
-	zarFooterLen = 7
-)
+func init() {
+	c.Register(c.TypeZAR, format{})
+}
 
-// A temporary struct to hold metadata read from the footer directory.
-type zarEntry struct {
-	cSize    uint32 // Compressed file size
-	fnSize   int    // Filename length
-	fnOff    int    // Filename offset
-	fnLenOff int    // Filename Length byte offset
-	fn       string // Filename for this header.
+// format implements c.Format for ZAR archives.
+type format struct{}
+
+func (format) Name() string      { return "ZAR" }
+func (format) Signature() []byte { return c.Signatures[c.TypeZAR] }
+
+func (format) Match(header, footer []byte) bool {
+	return bytes.HasSuffix(footer, c.Signatures[c.TypeZAR])
+}
+
+func (format) List(rs io.ReadSeeker) ([]c.Header, error) {
+	return List(rs)
+}
+
+func (format) NewReader(rs io.ReadSeeker) c.MemberReader {
+	return NewReader(rs)
 }
 
-type header struct {
-	id    []byte // Stores the file sig
-	fSize int    // Total file size
+func (format) Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	return Extract(rs)
 }
 
-// Seeks backwards len bytes, reads forwards, then returns to original position in file.
-func readBack(f io.ReadSeeker, len int64) ([]byte, error) {
-	buf := make([]byte, len)
-	_, err := f.Seek(-len, io.SeekCurrent)
+// Probe checks the signature, the table of contents and the first member of
+// a ZAR archive. The signature is weak evidence on its own, since it is only
+// three bytes at the end of the file.
+func (format) Probe(rs io.ReadSeeker) c.Candidate {
+	var cd c.Candidate
+	info, err := ReadInfo(rs)
 	if err != nil {
-		return nil, err
+		return cd
 	}
-	_, err = f.Read(buf)
-	if err != nil {
-		return nil, err
+	sig := c.Signatures[c.TypeZAR]
+	if info.Version == Version(sig[2]) {
+		cd.Add(10, "signature %q at end", sig)
+	} else {
+		cd.Add(0, "info block of unknown version %s at end", info.Version)
 	}
-	_, err = f.Seek(-len, io.SeekCurrent)
-	if err != nil {
-		return nil, err
-	}
-
-	return buf, nil
-}
 
-// fTell returns the current position in the file.
-func fTell(f io.ReadSeeker) (int, error) {
-	pos, err := f.Seek(0, io.SeekCurrent)
+	headers, err := List(rs)
 	if err != nil {
-		return 0, err
+		cd.Add(-20, "table of contents is invalid: %v", err)
+		return cd
 	}
-	_, err = f.Seek(pos, io.SeekStart)
+	size, err := c.ArchiveSize(rs)
 	if err != nil {
-		return 0, err
+		return cd
 	}
-
-	return int(pos), nil
+	if len(headers) == 0 {
+		if size == infoLen {
+			cd.Add(40, "table of contents is empty and no data is stored")
+		}
+		return cd
+	}
+	cd.Add(20, "table of contents lists %d member(s) within the data", len(headers))
+	cd.AddMember(rs, &headers[0], size)
+	return cd
 }
 
-// Extract processes a ZAR archive and extracts all contained files.
-func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+const (
+	// infoLen is the length of the info block at the end of every ZAR
+	// archive: configuration (2), TOC size (2), "PT" (2) and version (1).
+	infoLen = 7
+)
 
-	var (
-		bytesRead   int
-		headerBytes int
-		entries     []*zarEntry
-		allFiles    []c.ExtractedFileData
-	)
+// Config is the configuration word stored in the ZAR info block.
+type Config uint16
 
-	// Get filesize and initialize the header struct.
-	fs, err := rs.Seek(0, io.SeekEnd)
-	if err != nil {
-		return nil, fmt.Errorf("ZAR: could not determine file size: %w", err)
-	}
+// Speed returns the compression speed setting the archive was created with.
+func (cfg Config) Speed() int { return int(cfg & 0x0003) }
 
-	h := &header{
-		id:    make([]byte, len(c.Signatures[c.TypeZAR])),
-		fSize: int(fs),
-	}
+// Directories reports whether the table of contents includes directory paths,
+// as written by the -v option.
+func (cfg Config) Directories() bool { return cfg&0x0004 != 0 }
+
+// MultiVolume reports whether the archive was split across several files
+// with the volume number as a suffix.
+func (cfg Config) MultiVolume() bool { return cfg&0x0080 != 0 }
+
+// Version is the version of Zip Archive that created an archive. The high
+// nibble holds the major and the low nibble the minor version number.
+type Version byte
+
+// String returns the version as "major.minor", e.g. "2.6".
+func (v Version) String() string { return fmt.Sprintf("%d.%d", v>>4, v&0x0f) }
 
-	// Read the file id from the end.
-	_, err = rs.Seek(-3, io.SeekEnd)
+// Info is the decoded info block found at the very end of a ZAR archive.
+type Info struct {
+	Config  Config
+	TOCSize uint16 // Length of the table of contents in bytes.
+	Version Version
+}
+
+// formatError returns a *c.FormatError of the given kind for the member'th
+// member of a ZAR archive, or for the archive as a whole if member is -1.
+func formatError(member int, offset int64, kind error, format string, args ...any) error {
+	return c.NewFormatError("ZAR", member, offset, kind, fmt.Errorf(format, args...))
+}
+
+// ReadInfo reads and decodes the info block at the end of rs.
+func ReadInfo(rs io.ReadSeeker) (*Info, error) {
+	start, err := rs.Seek(-infoLen, io.SeekEnd)
 	if err != nil {
-		return nil, fmt.Errorf("ZAR: could not seek to the end of the file: %w", err)
+		return nil, formatError(-1, -1, c.ErrTruncated, "could not seek to info block: %w", err)
+	}
+	buf := make([]byte, infoLen)
+	if _, err := io.ReadFull(rs, buf); err != nil {
+		return nil, formatError(-1, start, c.ErrTruncated, "could not read info block: %w", err)
+	}
+	if !bytes.Equal(buf[4:6], c.Signatures[c.TypeZAR][:2]) {
+		return nil, formatError(-1, start+4, c.ErrBadMagic, "missing archive identifier, got %q", buf[4:6])
 	}
+	return &Info{
+		Config:  Config(binary.LittleEndian.Uint16(buf[0:2])),
+		TOCSize: binary.LittleEndian.Uint16(buf[2:4]),
+		Version: Version(buf[6]),
+	}, nil
+}
 
-	_, err = rs.Read(h.id)
-	if err != nil {
-		return nil, fmt.Errorf("ZAR: could not read the file magic: %w", err)
+// attributes decodes the attribute bits stored in the high nibble of a
+// filename length byte: read-only, hidden, system and archive from bit 4 up.
+func attributes(b byte) c.Attributes {
+	var a c.Attributes
+	for i, bit := range []c.Attributes{c.AttrReadOnly, c.AttrHidden, c.AttrSystem, c.AttrArchive} {
+		if b&(0x10<<i) != 0 {
+			a |= bit
+		}
 	}
+	return a
+}
 
-	bytesRead = bytesRead + 3
+// zarEntry is a single table of contents entry.
+type zarEntry struct {
+	cSize uint32       // Compressed file size
+	attr  c.Attributes // DOS attributes from the high nibble of the length byte
+	fn    string       // Filename for this entry, including its directory if stored
+}
 
-	// Skip backwards 4 bytes past the 2 unknown uint16s.
-	_, err = rs.Seek(-7, io.SeekCurrent)
+// readDirectory reads the info block and the table of contents stored before
+// it, returning the entries in archive order.
+func readDirectory(rs io.ReadSeeker) (*Info, []*zarEntry, error) {
+	info, err := ReadInfo(rs)
 	if err != nil {
-		return nil, fmt.Errorf("ZAR: could not seek backwards 7 bytes: %w", err)
+		return nil, nil, err
+	}
+	fs, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ZAR: could not determine file size: %w", err)
+	}
+	dataSize := fs - infoLen - int64(info.TOCSize)
+	if dataSize < 0 {
+		return nil, nil, formatError(-1, fs-infoLen, c.ErrCorruptHeader, "table of contents size %d exceeds file size %d", info.TOCSize, fs)
+	}
+	if _, err := rs.Seek(dataSize, io.SeekStart); err != nil {
+		return nil, nil, fmt.Errorf("ZAR: could not seek to table of contents: %w", err)
+	}
+	toc := make([]byte, info.TOCSize)
+	if _, err := io.ReadFull(rs, toc); err != nil {
+		return nil, nil, formatError(-1, dataSize, c.ErrTruncated, "could not read table of contents: %w", err)
 	}
 
-	bytesRead = bytesRead + 4
-
-	// Read archive entries in a loop.
-	for {
-		// Read filesize first.
-		buf, err := readBack(rs, 4)
-		if err != nil {
-			return nil, fmt.Errorf("ZAR: could not read compressed size: %w", err)
+	var (
+		entries []*zarEntry
+		total   int64
+		dir     string // Directory of the previous entry, for -v archives.
+	)
+	for p := 0; p < len(toc); {
+		if info.Config.Directories() {
+			// Each entry starts with the number of characters shared with
+			// the previous directory and the remaining part of its own.
+			if p+2 > len(toc) || p+2+int(toc[p+1]) > len(toc) {
+				return nil, nil, formatError(len(entries), dataSize+int64(p), c.ErrCorruptHeader, "table of contents entry is truncated")
+			}
+			shared, n := int(toc[p]), int(toc[p+1])
+			if shared > len(dir) {
+				return nil, nil, formatError(len(entries), dataSize+int64(p), c.ErrCorruptHeader, "table of contents entry shares %d characters of %q", shared, dir)
+			}
+			dir = dir[:shared] + string(toc[p+2:p+2+n])
+			p += 2 + n
 		}
-
-		e := &zarEntry{
-			cSize: binary.LittleEndian.Uint32(buf),
+		if p >= len(toc) {
+			return nil, nil, formatError(len(entries), dataSize+int64(p), c.ErrCorruptHeader, "table of contents entry is truncated")
 		}
 
-		bytesRead = bytesRead + 4
-
-		// Store current cursor and return to current pos.
-		pos, err := fTell(rs)
-		if err != nil {
-			return nil, fmt.Errorf("ZAR: could not get current position in file: %w", err)
+		fnSize := int(toc[p] & 0x0f)
+		if p+1+fnSize+4 > len(toc) {
+			return nil, nil, formatError(len(entries), dataSize+int64(p), c.ErrCorruptHeader, "table of contents entry is truncated")
 		}
+		e := &zarEntry{
+			fn:    dir + string(toc[p+1:p+1+fnSize]),
+			cSize: binary.LittleEndian.Uint32(toc[p+1+fnSize:]),
+			attr:  attributes(toc[p]),
+		}
+		p += 1 + fnSize + 4
 
-		// Read the filename bytes until we reach the filelen indicator.
-		for count := h.fSize - zarFooterLen - headerBytes; ; count-- {
-			buf, err := readBack(rs, 1)
-			if err != nil {
-				return nil, fmt.Errorf("ZAR: could not read filename byte: %w", err)
-			}
+		total += int64(e.cSize)
+		entries = append(entries, e)
+	}
+	if total > dataSize {
+		return nil, nil, formatError(-1, dataSize, c.ErrTruncated, "members need %d bytes but only %d are stored", total, dataSize)
+	}
 
-			bv := int(buf[0]) - 0x80
-			pc := int(pos) - count + 4
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, fmt.Errorf("ZAR: could not seek to start of file: %w", err)
+	}
+	return info, entries, nil
+}
 
-			if bv == pc {
-				e.fnSize = bv
-				pos, err = fTell(rs)
-				if err != nil {
-					return nil, fmt.Errorf("ZAR: could not get position after reading filename size: %w", err)
-				}
+// List returns the member headers from the directory in the footer of a ZAR
+// archive without reading the data region. ZAR does not store decompressed
+// sizes, so they are reported as zero.
+func List(rs io.ReadSeeker) ([]c.Header, error) {
+	info, entries, err := readDirectory(rs)
+	if err != nil {
+		return nil, err
+	}
 
-				e.fnLenOff = pos
-				e.fnOff = pos + 1
+	var (
+		headers []c.Header
+		offset  int64
+		speed   = info.Config.Speed()
+	)
+	for _, entry := range entries {
+		headers = append(headers, c.Header{
+			Filename:       entry.fn,
+			CompressedSize: entry.cSize,
+			Version:        info.Version.String(),
+			Speed:          &speed,
+			Attributes:     entry.attr,
+			Offset:         offset,
+		})
+		offset += int64(entry.cSize)
+	}
+	return headers, nil
+}
 
-				headerBytes = headerBytes + e.fnSize + 4 + 1
-				bytesRead = bytesRead + e.fnSize + 1 // +1 for the filesize byte itself.
-				break
-			}
-		}
+// Reader provides sequential access to the members of a ZAR archive.
+type Reader struct {
+	rs      io.ReadSeeker
+	headers []c.Header // Member headers, read from the directory on first use.
+	started bool       // The directory has been read.
+	n       int        // Number of members read so far.
+	err     error      // Sticky error.
+}
 
-		if e.fnSize > 12 {
-			fmt.Fprintf(os.Stderr, "filename length is > 12: %d", e.fnSize)
-			os.Exit(1)
-		}
+// NewReader returns a Reader that reads members from rs.
+func NewReader(rs io.ReadSeeker) *Reader {
+	return &Reader{rs: rs}
+}
 
-		fn := make([]byte, e.fnSize)
-		_, err = rs.Seek(int64(e.fnOff), io.SeekStart)
-		if err != nil {
-			return nil, fmt.Errorf("ZAR: could not seek to filename offset: %w", err)
+// Next advances to the next member and returns its header and a reader for
+// its decompressed data. It returns io.EOF once there are no more members.
+func (r *Reader) Next() (*c.Header, io.Reader, error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if !r.started {
+		r.headers, r.err = List(r.rs)
+		if r.err != nil {
+			return nil, nil, r.err
 		}
+		r.started = true
+	}
+	if len(r.headers) == 0 {
+		r.err = io.EOF
+		return nil, nil, r.err
+	}
 
-		_, err = rs.Read(fn)
-		if err != nil {
-			return nil, fmt.Errorf("ZAR: could not read filename: %w", err)
-		}
-		e.fn = string(fn)
+	h := &r.headers[0]
+	r.headers = r.headers[1:]
+	r.n++
+	if _, err := r.rs.Seek(h.Offset, io.SeekStart); err != nil {
+		r.err = fmt.Errorf("ZAR: seeking to member '%s': %w", h.Filename, err)
+		return nil, nil, r.err
+	}
 
-		_, err = rs.Seek(int64(e.fnLenOff), io.SeekStart)
-		if err != nil {
-			return nil, fmt.Errorf("ZAR: could not seek to filename length offset: %w", err)
-		}
+	// ZAR does not store the decompressed size, so we pass 0.
+	return h, c.NewMemberReader(r.rs, "ZAR", r.n-1, h), nil
+}
 
-		bytesRead = bytesRead + int(e.cSize)
-		entries = append(entries, e)
+// Extract processes a ZAR archive and extracts all contained files.
+func Extract(rs io.ReadSeeker) ([]c.ExtractedFileData, error) {
+	var allFiles []c.ExtractedFileData
 
-		if bytesRead == h.fSize {
-			_, err := rs.Seek(0, io.SeekStart)
-			if err != nil {
-				return nil, fmt.Errorf("ZAR: could not seek to start of file: %w", err)
-			}
+	r := NewReader(rs)
+	for {
+		h, data, err := r.Next()
+		if err == io.EOF {
 			break
 		}
-	}
-
-	// Reverse the entries slice to ensure we read them in original order.
-	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
-		entries[i], entries[j] = entries[j], entries[i]
-	}
+		if err != nil {
+			return allFiles, err
+		}
 
-	for _, entry := range entries {
-		// ZAR does not store the decompressed size, so we pass 0.
-		decompressedData, err := c.ReadAndDecompressBlastData(rs, entry.cSize, 0)
+		decompressedData, err := io.ReadAll(data)
 		if err != nil {
-			return allFiles, fmt.Errorf("ZAR: processing data for member '%s': %w", entry.fn, err)
+			return allFiles, fmt.Errorf("processing data for member '%s': %w", h.Filename, err)
 		}
 
+		h.DecompressedSize = uint32(len(decompressedData))
 		allFiles = append(allFiles, c.ExtractedFileData{
-			Filename:         entry.fn,
-			Data:             decompressedData,
-			CompressedSize:   entry.cSize,
-			DecompressedSize: uint32(len(decompressedData)),
+			Header: *h,
+			Data:   decompressedData,
 		})
 	}
 
@@ -0,0 +1,277 @@
+package zar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	c "github.com/sourcekris/dclextract/common"
+)
+
+// entry returns a table of contents entry without a directory part: the
+// attribute bits and name length, the name and the compressed size.
+func entry(attr byte, name string, size uint32) []byte {
+	b := append([]byte{attr<<4 | byte(len(name))}, name...)
+	return binary.LittleEndian.AppendUint32(b, size)
+}
+
+// dirEntry returns the directory part of an entry in an archive made with
+// -v: the characters shared with the previous directory and the rest of it.
+func dirEntry(shared int, rest string) []byte {
+	return append([]byte{byte(shared), byte(len(rest))}, rest...)
+}
+
+// archive returns a ZAR archive with dataSize bytes of member data followed
+// by the table of contents toc and an info block.
+func archive(dataSize int, toc []byte, config Config, version byte) []byte {
+	b := make([]byte, dataSize)
+	b = append(b, toc...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(config))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(toc)))
+	return append(b, 'P', 'T', version)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestReadInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		want        Info
+		speed       int
+		directories bool
+		multiVolume bool
+		wantErr     error
+	}{
+		{
+			name: "plain",
+			data: archive(0, nil, 0x0000, 0x26),
+			want: Info{Config: 0x0000, TOCSize: 0, Version: 0x26},
+		},
+		{
+			name:  "speed",
+			data:  archive(0, nil, 0x0003, 0x26),
+			want:  Info{Config: 0x0003, Version: 0x26},
+			speed: 3,
+		},
+		{
+			name:        "directories",
+			data:        archive(4, entry(8, "A.TXT", 4), 0x0006, 0x31),
+			want:        Info{Config: 0x0006, TOCSize: 10, Version: 0x31},
+			speed:       2,
+			directories: true,
+		},
+		{
+			name:        "multiple volumes",
+			data:        archive(0, nil, 0x0081, 0x26),
+			want:        Info{Config: 0x0081, Version: 0x26},
+			speed:       1,
+			multiVolume: true,
+		},
+		{
+			name:    "missing identifier",
+			data:    []byte{0, 0, 0, 0, 'P', 'K', 0x26},
+			wantErr: c.ErrBadMagic,
+		},
+		{
+			name:    "shorter than the info block",
+			data:    []byte{'P', 'T', 0x26},
+			wantErr: c.ErrTruncated,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := ReadInfo(bytes.NewReader(tc.data))
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("ReadInfo error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadInfo: %v", err)
+			}
+			if *info != tc.want {
+				t.Errorf("ReadInfo = %+v, want %+v", *info, tc.want)
+			}
+			if got := info.Config.Speed(); got != tc.speed {
+				t.Errorf("Speed() = %d, want %d", got, tc.speed)
+			}
+			if got := info.Config.Directories(); got != tc.directories {
+				t.Errorf("Directories() = %v, want %v", got, tc.directories)
+			}
+			if got := info.Config.MultiVolume(); got != tc.multiVolume {
+				t.Errorf("MultiVolume() = %v, want %v", got, tc.multiVolume)
+			}
+		})
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	for v, want := range map[Version]string{0x26: "2.6", 0x31: "3.1", 0x10: "1.0"} {
+		if got := v.String(); got != want {
+			t.Errorf("Version(%#x).String() = %q, want %q", byte(v), got, want)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	// Bit 4 is read-only, bit 5 hidden, bit 6 system and bit 7 archive.
+	want := []string{
+		"----", "R---", "-H--", "RH--", "--S-", "R-S-", "-HS-", "RHS-",
+		"---A", "R--A", "-H-A", "RH-A", "--SA", "R-SA", "-HSA", "RHSA",
+	}
+	for nibble, w := range want {
+		if got := attributes(byte(nibble)<<4 | 0x0c).String(); got != w {
+			t.Errorf("attributes(%#02x) = %s, want %s", nibble<<4|0x0c, got, w)
+		}
+
+		// The attributes do not change the length of the name.
+		headers, err := List(bytes.NewReader(archive(10, entry(byte(nibble), "BEWERBUN.WRI", 10), 0, 0x26)))
+		if err != nil {
+			t.Fatalf("List with attributes %s: %v", w, err)
+		}
+		if h := headers[0]; h.Filename != "BEWERBUN.WRI" || h.Attributes.String() != w {
+			t.Errorf("List with attributes %s = %q with attributes %s", w, h.Filename, h.Attributes)
+		}
+	}
+}
+
+func TestListSpeed(t *testing.T) {
+	headers, err := List(bytes.NewReader(archive(10, entry(0, "A.TXT", 10), 0x0003, 0x26)))
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(headers) != 1 || headers[0].Speed == nil || *headers[0].Speed != 3 {
+		t.Errorf("List = %+v, want one member with speed 3", headers)
+	}
+}
+
+// listMember is a member expected from List.
+type listMember struct {
+	name   string
+	size   uint32
+	offset int64
+}
+
+// listTest is a case for testList.
+type listTest struct {
+	name    string
+	data    []byte
+	want    []listMember
+	wantErr error
+}
+
+// testList runs List on the data of each case and checks the members or the
+// error it returns.
+func testList(t *testing.T, tests []listTest) {
+	t.Helper()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			headers, err := List(bytes.NewReader(tc.data))
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("List error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(headers) != len(tc.want) {
+				t.Fatalf("List returned %d members, want %d", len(headers), len(tc.want))
+			}
+			for i, w := range tc.want {
+				h := headers[i]
+				if h.Filename != w.name || h.CompressedSize != w.size || h.Offset != w.offset {
+					t.Errorf("member %d = %q, %d bytes at %d; want %q, %d bytes at %d", i, h.Filename, h.CompressedSize, h.Offset, w.name, w.size, w.offset)
+				}
+				if h.Version != "2.6" {
+					t.Errorf("member %d version = %q, want 2.6", i, h.Version)
+				}
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	testList(t, []listTest{
+		{
+			name: "empty",
+			data: archive(0, nil, 0, 0x26),
+		},
+		{
+			// #7'WIN.COM'....#11'WINDOWS.HLP'....#12'BEWERBUN.WRI'....
+			name: "without directories",
+			data: archive(60, concat(
+				entry(0, "WIN.COM", 10),
+				entry(0, "WINDOWS.HLP", 20),
+				entry(0, "BEWERBUN.WRI", 30),
+			), 0, 0x26),
+			want: []listMember{
+				{"WIN.COM", 10, 0},
+				{"WINDOWS.HLP", 20, 10},
+				{"BEWERBUN.WRI", 30, 30},
+			},
+		},
+		{
+			name: "data after the members",
+			data: archive(100, entry(0, "A.TXT", 40), 0, 0x26),
+			want: []listMember{{"A.TXT", 40, 0}},
+		},
+		{
+			name:    "table of contents larger than the file",
+			data:    concat([]byte{0, 0}, binary.LittleEndian.AppendUint16(nil, 100), []byte("PT&")),
+			wantErr: c.ErrCorruptHeader,
+		},
+		{
+			name:    "name runs past the table of contents",
+			data:    archive(10, entry(0, "A.TXT", 10)[:8], 0, 0x26),
+			wantErr: c.ErrCorruptHeader,
+		},
+		{
+			name:    "members larger than the data",
+			data:    archive(10, concat(entry(0, "A.TXT", 6), entry(0, "B.TXT", 6)), 0, 0x26),
+			wantErr: c.ErrTruncated,
+		},
+	})
+}
+
+// TestListDirectories checks that the directory paths of archives made with
+// the -v option are reconstructed from the parts shared between entries.
+func TestListDirectories(t *testing.T) {
+	testList(t, []listTest{
+		{
+			// #0#11'C:\WINDOWS\'#7'WIN.COM'....#11#0'WINDOWS.HLP'....
+			// #4#6'RITER\'#12'BEWERBUN.WRI'....
+			name: "shared prefixes",
+			data: archive(60, concat(
+				dirEntry(0, `C:\WINDOWS\`), entry(0, "WIN.COM", 10),
+				dirEntry(11, ""), entry(0, "WINDOWS.HLP", 20),
+				dirEntry(4, `RITER\`), entry(0, "BEWERBUN.WRI", 30),
+			), 0x0004, 0x26),
+			want: []listMember{
+				{`C:\WINDOWS\WIN.COM`, 10, 0},
+				{`C:\WINDOWS\WINDOWS.HLP`, 20, 10},
+				{`C:\WRITER\BEWERBUN.WRI`, 30, 30},
+			},
+		},
+		{
+			name:    "directory runs past the table of contents",
+			data:    archive(10, dirEntry(0, `C:\DOS\`)[:5], 0x0004, 0x26),
+			wantErr: c.ErrCorruptHeader,
+		},
+		{
+			name:    "directory without a file entry",
+			data:    archive(10, dirEntry(0, `C:\DOS\`), 0x0004, 0x26),
+			wantErr: c.ErrCorruptHeader,
+		},
+		{
+			name:    "more shared characters than the previous directory",
+			data:    archive(10, concat(dirEntry(3, `DOS\`), entry(0, "A.TXT", 10)), 0x0004, 0x26),
+			wantErr: c.ErrCorruptHeader,
+		},
+	})
+}